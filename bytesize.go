@@ -0,0 +1,75 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// byteUnits maps the lower case unit suffixes of byte sizes to their number
+// of bytes: SI units are powers of 1000 and IEC units powers of 1024.
+var byteUnits = map[string]uint64{
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+// parseByteSize parses a size such as 256MB, 2GiB or 1.5 KB into a number of
+// bytes. A plain number is a number of bytes.
+func parseByteSize(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(value)
+	}
+	number, unit := value[:i], strings.ToLower(strings.TrimSpace(value[i:]))
+
+	mult := uint64(1)
+	if unit != "" {
+		var ok bool
+		if mult, ok = byteUnits[unit]; !ok {
+			return 0, fmt.Errorf("unknown byte size unit %q", value[i:])
+		}
+	}
+
+	if !strings.Contains(number, ".") {
+		n, err := strconv.ParseUint(number, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if n > math.MaxUint64/mult {
+			return 0, fmt.Errorf("byte size %q overflows: %w", value, strconv.ErrRange)
+		}
+		return n * mult, nil
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	bytes := f * float64(mult)
+	if bytes != math.Trunc(bytes) {
+		return 0, fmt.Errorf("byte size %q is not a whole number of bytes", value)
+	}
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("byte size %q overflows: %w", value, strconv.ErrRange)
+	}
+	return uint64(bytes), nil
+}
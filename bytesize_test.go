@@ -0,0 +1,90 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]uint64{
+		"512":     512,
+		"10B":     10,
+		"256MB":   256e6,
+		"2GiB":    2 << 30,
+		"1.5 KB":  1500,
+		"4kib":    4096,
+		"0.5MiB":  1 << 19,
+		"16EiB":   0,
+		"1.1B":    0,
+		"10XB":    0,
+		"MB":      0,
+		"-5MB":    0,
+		"":        0,
+		"1.2.3KB": 0,
+	} {
+		size, err := parseByteSize(value)
+		if expected == 0 {
+			if err == nil {
+				t.Errorf("expected an error for %q, got %d", value, size)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected %d for %q, got %v", expected, value, err)
+		} else if size != expected {
+			t.Errorf("expected %d for %q, got %d", expected, value, size)
+		}
+	}
+}
+
+func TestByteSizeFields(t *testing.T) {
+	var s struct {
+		MaxSize   int64    `format:"bytesize"`
+		CacheSize uint32   `format:"bytesize"`
+		Buffers   []uint64 `format:"bytesize"`
+		Small     int8     `format:"bytesize"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_MAXSIZE":   "256MB",
+		"ENV_CONFIG_CACHESIZE": "2GiB",
+		"ENV_CONFIG_BUFFERS":   "4KiB,1024",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxSize != 256e6 {
+		t.Errorf("expected %d, got %d", int64(256e6), s.MaxSize)
+	}
+	if s.CacheSize != 2<<30 {
+		t.Errorf("expected %d, got %d", 2<<30, s.CacheSize)
+	}
+	if expected := []uint64{4096, 1024}; !reflect.DeepEqual(s.Buffers, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Buffers)
+	}
+
+	if os.Setenv("ENV_CONFIG_SMALL", "1KB") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+	if os.Setenv("ENV_CONFIG_SMALL", "10") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_MAXSIZE", "10 bananas") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// loadDotEnv reads the dotenv files added with WithDotEnv into a single map.
+// Values from later files override those from earlier ones. Like config files,
+// dotenv files that can't be opened are skipped unless WithErrorOnMissingFile
+// is used.
+func loadDotEnv(o *options) (map[string]string, error) {
+	if len(o.dotenv) == 0 {
+		return nil, nil
+	}
+
+	env := make(map[string]string)
+	for _, path := range o.dotenv {
+		f, err := os.Open(path)
+		if err != nil {
+			if o.errorOnMissingFile && os.IsNotExist(err) {
+				return nil, &ConfigFileError{Path: path, Err: err}
+			}
+			continue
+		}
+		values, err := parseDotEnv(f)
+		f.Close()
+		if err != nil {
+			return nil, &ConfigFileError{Path: path, Err: err}
+		}
+		for k, v := range values {
+			env[k] = v
+		}
+	}
+	return env, nil
+}
+
+// parseDotEnv parses KEY=VALUE lines. Blank lines and lines starting with # are
+// ignored, an optional "export " prefix is dropped, and values may be wrapped
+// in single or double quotes. Escapes like \n are only expanded in double
+// quoted values, and unquoted values end at a " #" comment.
+func parseDotEnv(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "" {
+			return nil, fmt.Errorf("line %d: missing key", n)
+		}
+
+		value, err := dotEnvValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		env[key] = value
+	}
+	return env, scanner.Err()
+}
+
+func dotEnvValue(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	switch quote := raw[0]; quote {
+	case '\'':
+		end := strings.IndexByte(raw[1:], quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		return raw[1 : end+1], nil
+	case '"':
+		var b strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 't':
+					b.WriteByte('\t')
+				default:
+					b.WriteByte(raw[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated quoted value %s", raw)
+	}
+
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = strings.TrimSpace(raw[:i])
+	}
+	return raw, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	env, err := parseDotEnv(strings.NewReader(`
+# a comment
+HOST=localhost
+export PORT=8080
+NAME = "my app" 
+GREETING="hello\nworld"
+RAW='no \n escapes'
+USER=admin # trailing comment
+EMPTY=
+`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := map[string]string{
+		"HOST":     "localhost",
+		"PORT":     "8080",
+		"NAME":     "my app",
+		"GREETING": "hello\nworld",
+		"RAW":      `no \n escapes`,
+		"USER":     "admin",
+		"EMPTY":    "",
+	}
+	if len(env) != len(expected) {
+		t.Errorf("expected %d values, got %d", len(expected), len(env))
+	}
+	for k, v := range expected {
+		if env[k] != v {
+			t.Errorf("expected %q for %s, got %q", v, k, env[k])
+		}
+	}
+}
+
+func TestParseDotEnvMalformed(t *testing.T) {
+	for _, input := range []string{"HOST", "=value", `HOST="localhost`, "HOST='localhost"} {
+		if _, err := parseDotEnv(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestWithDotEnv(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string `default:"guest"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, ".env", "ENV_CONFIG_HOST=dotenv\nENV_CONFIG_PORT=80\n")
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = ProcessWithOptions(&s, WithPrefix("env_config"), WithDotEnv(path), WithDotEnv(dir+"/missing.env"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "dotenv" {
+		t.Errorf("expected %s, got %s", "dotenv", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "guest" {
+		t.Errorf("expected %s, got %s", "guest", s.User)
+	}
+}
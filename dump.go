@@ -0,0 +1,174 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dump returns the environment variables that would make Process reproduce
+// the current values of spec, such as for passing the config on to a
+// subprocess. Values are formatted the way they are parsed, so durations read
+// 1m30s and slices are joined by their delimiter. Fields with a nil pointer,
+// slice or map, including the fields of nil pointers to structs, and invalid
+// nullable values are left out. spec itself is left as is.
+func Dump(prefix string, spec interface{}) (map[string]string, error) {
+	return DumpWithOptions(spec, WithPrefix(prefix))
+}
+
+// DumpWithOptions is the same as Dump, configured by the given options, so
+// that the keys match those of ProcessWithOptions with the same options. With
+// WithRedactSecrets the values of fields tagged with `secret:"true"` are
+// replaced with "***", such as for logging.
+func DumpWithOptions(spec interface{}, opts ...Option) (map[string]string, error) {
+	if err := checkSpec(spec); err != nil {
+		return nil, err
+	}
+
+	o := newOptions(opts)
+	o.nilStructs = skipNilStructs
+	env := make(map[string]string)
+	for _, info := range gatherInfo(o, o.prefix, spec) {
+		if isNil(info.Field) {
+			continue
+		}
+		if o.redactSecrets && info.Tags.Get("secret") == "true" {
+			env[info.Key] = "***"
+			continue
+		}
+		env[info.Key] = formatField(info.Field, info.Tags)
+	}
+	for _, info := range gatherStructSlices(o, o.prefix, spec) {
+		env[info.Key] = strconv.Itoa(info.Field.Len())
+	}
+	return env, nil
+}
+
+// isNil reports whether v is a nil pointer, slice or map, or a nullable value,
+// possibly behind pointers, that isn't valid.
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr:
+		return v.IsNil() || isNil(v.Elem())
+	case reflect.Slice, reflect.Map:
+		return v.IsNil()
+	case reflect.Struct:
+		return isNullable(v.Type()) && !v.Field(1).Bool()
+	}
+	return false
+}
+
+// formatBase returns the base integers are formatted in, which is the one
+// given by the `base` tag or else 10.
+func formatBase(tag reflect.StructTag) int {
+	if base, err := baseFrom(tag); err == nil && base != 0 {
+		return base
+	}
+	return 10
+}
+
+// formatField formats the value of a field as processField would parse it,
+// honoring the same tags.
+func formatField(v reflect.Value, tag reflect.StructTag) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	typ := v.Type()
+	if typ == timeType {
+		t := v.Interface().(time.Time)
+		switch layout := tag.Get("timeformat"); layout {
+		case "":
+			return t.Format(time.RFC3339)
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10)
+		case "unixmilli":
+			return strconv.FormatInt(t.UnixMilli(), 10)
+		default:
+			return t.Format(layout)
+		}
+	}
+	if isStandardType(typ) || typ == durationType || implementsParser(typ) {
+		return formatValue(v)
+	}
+	if isNullable(typ) {
+		if !v.Field(1).Bool() {
+			return ""
+		}
+		return formatField(v.Field(0), tag)
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), formatBase(tag))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), formatBase(tag))
+	case reflect.Float32, reflect.Float64:
+		s := strconv.FormatFloat(v.Float(), 'g', -1, typ.Bits())
+		if sep := tag.Get("decimal"); sep != "" {
+			s = strings.Replace(s, ".", sep, 1)
+		}
+		return s
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, typ.Bits())
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 && typ.Kind() == reflect.Slice {
+			switch tag.Get("encoding") {
+			case "hex":
+				return hex.EncodeToString(v.Bytes())
+			case "raw":
+				return string(v.Bytes())
+			}
+			return base64.StdEncoding.EncodeToString(v.Bytes())
+		}
+		delimiter := delimiterFrom(tag)
+		elems := make([]string, v.Len())
+		for i := range elems {
+			elems[i] = formatField(v.Index(i), tag)
+		}
+		return joinEscaped(elems, delimiter)
+	case reflect.Map:
+		if tag.Get("format") == "querystring" {
+			query := make(url.Values, v.Len())
+			for _, key := range v.MapKeys() {
+				k, elem := formatField(key, tag), v.MapIndex(key)
+				if elem.Kind() == reflect.Slice && elem.Type().Elem().Kind() != reflect.Uint8 {
+					for i := 0; i < elem.Len(); i++ {
+						query.Add(k, formatField(elem.Index(i), tag))
+					}
+					continue
+				}
+				query.Set(k, formatField(elem, tag))
+			}
+			return query.Encode()
+		}
+		separator := tag.Get("separator")
+		if separator == "" {
+			separator = ":"
+		}
+		delimiter := delimiterFrom(tag)
+		pairs := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			pairs = append(pairs, formatField(key, tag)+separator+formatField(v.MapIndex(key), tag))
+		}
+		sort.Strings(pairs)
+		return joinEscaped(pairs, delimiter)
+	}
+	return formatValue(v)
+}
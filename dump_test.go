@@ -0,0 +1,123 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type dumpSpecification struct {
+	Host     string
+	Port     int
+	Color    uint32 `base:"16"`
+	Ratio    float64
+	Debug    bool
+	Timeout  time.Duration
+	Started  time.Time `timeformat:"2006-01-02"`
+	Tags     []string  `delimiter:";"`
+	Limits   map[string]int
+	Key      []byte
+	Level    *int
+	Password string `secret:"true"`
+	Ignored  string `ignored:"true"`
+	Database struct {
+		Name string `envconfig:"db_name"`
+	}
+}
+
+func TestDump(t *testing.T) {
+	level := 3
+	s := dumpSpecification{
+		Host:     "localhost",
+		Port:     8080,
+		Color:    0xff8800,
+		Ratio:    0.5,
+		Debug:    true,
+		Timeout:  90 * time.Second,
+		Started:  time.Date(2016, 8, 16, 0, 0, 0, 0, time.UTC),
+		Tags:     []string{"a", "b"},
+		Limits:   map[string]int{"b": 2, "a": 1},
+		Key:      []byte("hello world"),
+		Level:    &level,
+		Password: "hunter2",
+		Ignored:  "ignored",
+	}
+	s.Database.Name = "app"
+
+	env, err := Dump("env_config", &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{
+		"ENV_CONFIG_HOST":             "localhost",
+		"ENV_CONFIG_PORT":             "8080",
+		"ENV_CONFIG_COLOR":            "ff8800",
+		"ENV_CONFIG_RATIO":            "0.5",
+		"ENV_CONFIG_DEBUG":            "true",
+		"ENV_CONFIG_TIMEOUT":          "1m30s",
+		"ENV_CONFIG_STARTED":          "2016-08-16",
+		"ENV_CONFIG_TAGS":             "a;b",
+		"ENV_CONFIG_LIMITS":           "a:1,b:2",
+		"ENV_CONFIG_KEY":              "aGVsbG8gd29ybGQ=",
+		"ENV_CONFIG_LEVEL":            "3",
+		"ENV_CONFIG_PASSWORD":         "hunter2",
+		"ENV_CONFIG_DATABASE_DB_NAME": "app",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+
+	var parsed dumpSpecification
+	if err := ProcessMap("env_config", env, &parsed); err != nil {
+		t.Fatal(err.Error())
+	}
+	s.Ignored = ""
+	if !reflect.DeepEqual(parsed, s) {
+		t.Errorf("expected %+v, got %+v", s, parsed)
+	}
+
+	env, err = DumpWithOptions(&s, WithPrefix("env_config"), WithRedactSecrets())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env["ENV_CONFIG_PASSWORD"] != "***" || env["ENV_CONFIG_HOST"] != "localhost" {
+		t.Errorf("expected only the secret to be redacted, got %v", env)
+	}
+}
+
+func TestDumpNilStruct(t *testing.T) {
+	type inner struct {
+		A string
+	}
+	var s struct {
+		In      *inner
+		Servers []*inner
+	}
+	s.Servers = []*inner{nil, {A: "b"}}
+
+	env, err := Dump("env_config", &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]string{
+		"ENV_CONFIG_SERVERS_COUNT": "2",
+		"ENV_CONFIG_SERVERS_1_A":   "b",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("expected %v, got %v", expected, env)
+	}
+	if s.In != nil || s.Servers[0] != nil {
+		t.Errorf("expected nil pointers to be left as is, got %v and %v", s.In, s.Servers[0])
+	}
+}
+
+func TestDumpInvalidSpecification(t *testing.T) {
+	if _, err := Dump("env_config", dumpSpecification{}); !errors.Is(err, ErrInvalidSpecification) {
+		t.Errorf("expected %v, got %v", ErrInvalidSpecification, err)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// flagName derives the name of the command-line flag for key, such as
+// app-db-host for APP_DB_HOST.
+func flagName(o *options, key string) string {
+	name := strings.ToLower(key)
+	if o.keySeparator != "" {
+		name = strings.Replace(name, strings.ToLower(o.keySeparator), "-", -1)
+	}
+	return strings.Replace(name, "_", "-", -1)
+}
+
+// flagValue holds the raw value of a flag registered for a field, which is
+// converted by processField like any other value.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.value
+}
+
+func (v *flagValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+// IsBoolFlag lets boolean fields be set with a bare -name, like flag.Bool.
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// processFlags registers a flag for every key of spec on o.flagSet, parses
+// o.flagArgs and applies the flags that were given, overriding every other
+// layer. Flags that are already defined on the FlagSet are left alone, so
+// that processing can be repeated.
+func processFlags(o *options, spec interface{}) error {
+	flags := o.flagSet
+	keys := make(map[string]string)
+	infos := gatherInfo(o, o.prefix, spec)
+	infos = append(infos, gatherStructSlices(o, o.prefix, spec)...)
+	for _, info := range infos {
+		name := flagName(o, info.Key)
+		keys[name] = info.Key
+		if flags.Lookup(name) != nil {
+			continue
+		}
+		t := info.Field.Type()
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		flags.Var(&flagValue{isBool: t.Kind() == reflect.Bool}, name, info.Tags.Get("desc"))
+	}
+
+	args := o.flagArgs
+	if args == nil {
+		args = os.Args[1:]
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	flags.Visit(func(f *flag.Flag) {
+		if key, ok := keys[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+	return processSource(o, o.prefix, spec, MapLookuper(values), SourceFlag)
+}
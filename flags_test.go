@@ -0,0 +1,78 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWithFlagSet(t *testing.T) {
+	var s struct {
+		Debug    bool
+		Port     int `default:"80"`
+		Database struct {
+			Host string
+			User string
+		}
+		MultiWordVar string `split_words:"true"`
+	}
+	os.Clearenv()
+	if os.Setenv("APP_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("APP_DATABASE_HOST", "env-host") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("APP_DATABASE_USER", "env-user") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	flags := flag.NewFlagSet("app", flag.ContinueOnError)
+	config := flags.String("config", "", "config file")
+	args := []string{"-app-debug", "-app-database-host=flag-host", "-app-multi-word-var", "x", "-config", "app.json", "rest"}
+	o := newOptions([]Option{WithPrefix("app"), WithFlagSet(flags, args)})
+	if err := process(o, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	// -app-debug is a bool flag, so it takes no value
+	if !s.Debug {
+		t.Errorf("expected %t, got %t", true, s.Debug)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.Database.Host != "flag-host" {
+		t.Errorf("expected %s, got %s", "flag-host", s.Database.Host)
+	}
+	if s.Database.User != "env-user" {
+		t.Errorf("expected %s, got %s", "env-user", s.Database.User)
+	}
+	if s.MultiWordVar != "x" {
+		t.Errorf("expected %s, got %s", "x", s.MultiWordVar)
+	}
+	if *config != "app.json" {
+		t.Errorf("expected %s, got %s", "app.json", *config)
+	}
+	if flags.NArg() != 1 || flags.Arg(0) != "rest" {
+		t.Errorf("expected %v, got %v", []string{"rest"}, flags.Args())
+	}
+	if o.origins["Database.Host"].Source != SourceFlag {
+		t.Errorf("expected %v, got %v", SourceFlag, o.origins["Database.Host"].Source)
+	}
+
+	flags = flag.NewFlagSet("app", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	err := ProcessWithOptions(&s, WithPrefix("app"), WithFlagSet(flags, []string{"-app-port=eighty"}))
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected ParseError, got %v", err)
+	}
+	err = ProcessWithOptions(&s, WithPrefix("app"), WithFlagSet(flags, []string{"-unknown"}))
+	if err == nil {
+		t.Errorf("expected an error for an unknown flag")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// UnmarshalFunc decodes a config file into v, like json.Unmarshal. Functions
+// such as yaml.Unmarshal from gopkg.in/yaml.v3 satisfy it.
+type UnmarshalFunc func(data []byte, v interface{}) error
+
+// WithFileFormat loads config files whose names end in one of exts, such as
+// ".yaml", with unmarshal instead of as json. This keeps kkonfig free of
+// dependencies on other formats:
+//
+//	kkonfig.WithFileFormat(yaml.Unmarshal, ".yaml", ".yml")
+//
+// Files are decoded into generic maps and then converted to json, so fields
+// are matched exactly as they are in json files, using the json struct tags.
+func WithFileFormat(unmarshal UnmarshalFunc, exts ...string) Option {
+	return func(o *options) {
+		if o.formats == nil {
+			o.formats = make(map[string]UnmarshalFunc)
+		}
+		for _, ext := range exts {
+			o.formats[strings.ToLower(ext)] = unmarshal
+		}
+	}
+}
+
+// toJson converts the contents of a config file at path to json, if it is in
+// a format registered with WithFileFormat.
+func toJson(o *options, path string, data []byte) ([]byte, error) {
+	unmarshal, ok := o.formats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return data, nil
+	}
+
+	var v interface{}
+	if err := unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonCompatible(v))
+}
+
+// jsonCompatible converts maps with non-string keys, as produced by some
+// yaml decoders, into maps that encoding/json can marshal.
+func jsonCompatible(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = jsonCompatible(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = jsonCompatible(value)
+		}
+	}
+	return v
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// unmarshalDotted is a stand-in for a yaml decoder. It decodes lines of
+// dotted.key=value pairs into nested maps with interface{} keys, like
+// gopkg.in/yaml.v2 does.
+func unmarshalDotted(data []byte, v interface{}) error {
+	root := make(map[interface{}]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return errors.New("missing =")
+		}
+		m := root
+		keys := strings.Split(strings.TrimSpace(parts[0]), ".")
+		for _, key := range keys[:len(keys)-1] {
+			if _, ok := m[key]; !ok {
+				m[key] = make(map[interface{}]interface{})
+			}
+			m = m[key].(map[interface{}]interface{})
+		}
+		m[keys[len(keys)-1]] = strings.TrimSpace(parts[1])
+	}
+	*v.(*interface{}) = root
+	return nil
+}
+
+func TestWithFileFormat(t *testing.T) {
+	var s struct {
+		Host     string
+		Name     string `json:"service_name"`
+		Database struct {
+			Host string
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigFile(t, dir, "common.json", `{"Host": "localhost"}`)
+	path := writeConfigFile(t, dir, "config.yaml", "base=common.json\nservice_name=app\ndatabase.host=db.local\n")
+
+	err = ProcessWithOptions(&s, WithConfigPaths(path), WithFileFormat(unmarshalDotted, ".yaml", ".yml"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Name != "app" {
+		t.Errorf("expected %s, got %s", "app", s.Name)
+	}
+	if s.Database.Host != "db.local" {
+		t.Errorf("expected %s, got %s", "db.local", s.Database.Host)
+	}
+
+	broken := writeConfigFile(t, dir, "broken.yml", "nope")
+	err = ProcessWithOptions(&s, WithConfigPaths(broken), WithFileFormat(unmarshalDotted, ".yaml", ".yml"))
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError, got %v", err)
+	}
+}
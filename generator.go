@@ -0,0 +1,50 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// A DefaultGenerator computes a default value when a spec is processed, for
+// defaults that can't be written down statically such as the hostname.
+type DefaultGenerator func() (string, error)
+
+var (
+	generatorsMu sync.RWMutex
+	generators   = make(map[string]DefaultGenerator)
+)
+
+// RegisterDefault registers fn under name, so that a field tagged with
+// `default:"@name"` defaults to the value fn returns. Registering a name again
+// replaces its generator.
+func RegisterDefault(name string, fn DefaultGenerator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+	generators[name] = fn
+}
+
+// generateDefault resolves a default value that references a generator. A
+// leading @@ stands for a literal @.
+func generateDefault(value string) (string, error) {
+	if strings.HasPrefix(value, "@@") {
+		return value[1:], nil
+	}
+
+	name := value[1:]
+	generatorsMu.RLock()
+	fn, ok := generators[name]
+	generatorsMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("default references unknown generator %s", name)
+	}
+	generated, err := fn()
+	if err != nil {
+		return "", fmt.Errorf("generating default %s: %w", name, err)
+	}
+	return generated, nil
+}
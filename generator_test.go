@@ -0,0 +1,68 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRegisterDefault(t *testing.T) {
+	var s struct {
+		Host    string `default:"@test_host"`
+		Port    int    `default:"@test_port"`
+		Handle  string `default:"@@kkonfig"`
+		Literal string `default:"user@example.com"`
+	}
+	RegisterDefault("test_host", func() (string, error) {
+		return "generated", nil
+	})
+	RegisterDefault("test_port", func() (string, error) {
+		return "8080", nil
+	})
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "9090") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "generated" {
+		t.Errorf("expected %s, got %s", "generated", s.Host)
+	}
+	if s.Port != 9090 {
+		t.Errorf("expected %d, got %d", 9090, s.Port)
+	}
+	if s.Handle != "@kkonfig" {
+		t.Errorf("expected %s, got %s", "@kkonfig", s.Handle)
+	}
+	if s.Literal != "user@example.com" {
+		t.Errorf("expected %s, got %s", "user@example.com", s.Literal)
+	}
+}
+
+func TestRegisterDefaultErrors(t *testing.T) {
+	errGenerator := errors.New("no hostname")
+	RegisterDefault("test_failing", func() (string, error) {
+		return "", errGenerator
+	})
+	os.Clearenv()
+
+	var failing struct {
+		Host string `default:"@test_failing"`
+	}
+	err := Process("env_config", nil, &failing)
+	if v, ok := err.(*ParseError); !ok || !errors.Is(v.Err, errGenerator) || v.Value != "@test_failing" {
+		t.Errorf("expected ParseError wrapping the generator error, got %v", err)
+	}
+
+	var unknown struct {
+		Host string `default:"@test_unknown"`
+	}
+	if _, ok := Process("env_config", nil, &unknown).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// processJsonURL fetches the json document at url and unmarshals it into spec.
+// When optional is set, a document that can't be fetched is skipped.
+func processJsonURL(o *options, url string, optional bool, spec interface{}) error {
+	client := o.httpClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(o.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &ConfigFileError{Path: url, Err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctxErr := o.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if optional {
+			return nil
+		}
+		return &ConfigFileError{Path: url, Err: err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if optional {
+			return nil
+		}
+		return &ConfigFileError{Path: url, Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+	return processJsonReader(o, url, "", resp.Body, spec, nil)
+}
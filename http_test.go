@@ -0,0 +1,117 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWithConfigURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/config":
+			fmt.Fprint(w, `{"Host": "config-service", "Port": 80}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := ProcessWithOptions(&s,
+		WithPrefix("env_config"),
+		WithHTTPClient(server.Client()),
+		WithConfigURL(server.URL+"/config"),
+		WithOptionalConfigURL(server.URL+"/missing"),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "config-service" {
+		t.Errorf("expected %s, got %s", "config-service", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	missing := server.URL + "/missing"
+	err = ProcessWithOptions(&s, WithConfigURL(missing))
+	v, ok := err.(*ConfigFileError)
+	if !ok {
+		t.Fatalf("expected ConfigFileError, got %v", err)
+	}
+	if v.Path != missing {
+		t.Errorf("expected %s, got %s", missing, v.Path)
+	}
+}
+
+func TestProcessContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a hung config server
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	var s struct {
+		Host string
+	}
+	os.Clearenv()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := ProcessWithOptions(&s, WithContext(ctx), WithConfigURL(server.URL))
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := ProcessContext(ctx, "env_config", nil, &s); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	// reading a config stops once the context is done
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	r := cancelingReader{cancel: cancel, data: `{"Host": "localhost"}`}
+	if err := ProcessWithOptions(&s, WithContext(ctx), WithConfigReaders(&r)); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+
+	if err := ProcessWithOptions(&s, WithContext(nil)); err != nil {
+		t.Errorf("expected a nil context to be allowed, got %v", err)
+	}
+}
+
+// cancelingReader returns its data one byte at a time and cancels a context
+// after the first one.
+type cancelingReader struct {
+	cancel func()
+	data   string
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	r.cancel()
+	n := copy(p[:1], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
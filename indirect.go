@@ -0,0 +1,60 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"strings"
+)
+
+// resolveIndirect follows an environment value of the form @ENV:NAME, which
+// stands for the value of the variable NAME in env, or @FILE:PATH, which
+// stands for the contents of the file at PATH without a single trailing
+// newline, read from the filesystem set with WithFS if there is one. A leading
+// @@ stands for a literal @, and other values are returned unchanged. Values
+// are only resolved when WithIndirection is used.
+func resolveIndirect(o *options, value string, env ConfigSource) (string, error) {
+	if !o.indirection || !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+	if strings.HasPrefix(value, "@@") {
+		return value[1:], nil
+	}
+
+	parts := strings.SplitN(value[1:], ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("indirection %q has no scheme, use @@ for a literal @", value)
+	}
+	scheme, ref := parts[0], parts[1]
+	switch scheme {
+	case "ENV":
+		resolved, ok := env.Lookup(ref)
+		if !ok {
+			return "", fmt.Errorf("indirection to %s, which is not set", ref)
+		}
+		return resolved, nil
+	case "FILE":
+		return readValueFile(o, ref)
+	}
+	return "", fmt.Errorf("unknown indirection scheme %q", scheme)
+}
+
+// readValueFile returns the contents of the file at path, read from the
+// filesystem set with WithFS if any, without a single trailing newline.
+func readValueFile(o *options, path string) (string, error) {
+	var contents []byte
+	var err error
+	if o.fsys != nil {
+		contents, err = fs.ReadFile(o.fsys, path)
+	} else {
+		contents, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(contents), "\n"), "\r"), nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithIndirection(t *testing.T) {
+	var s struct {
+		DSN      string
+		Password string `secret:"true"`
+		Handle   string
+		Port     int `deprecated:"OLD_PORT"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	password := writeConfigFile(t, dir, "password", "hunter2\n")
+
+	for key, value := range map[string]string{
+		"SHARED_DSN":   "postgres://db",
+		"APP_DSN":      "@ENV:SHARED_DSN",
+		"APP_PASSWORD": "@FILE:" + password,
+		"APP_HANDLE":   "@@kkonfig",
+		"OLD_PORT":     "@ENV:PORT",
+		"PORT":         "8080",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithIndirection()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.DSN != "postgres://db" {
+		t.Errorf("expected %s, got %s", "postgres://db", s.DSN)
+	}
+	if s.Password != "hunter2" {
+		t.Errorf("expected %s, got %s", "hunter2", s.Password)
+	}
+	if s.Handle != "@kkonfig" {
+		t.Errorf("expected %s, got %s", "@kkonfig", s.Handle)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	// without the option, values are taken literally
+	os.Unsetenv("OLD_PORT")
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.DSN != "@ENV:SHARED_DSN" {
+		t.Errorf("expected %s, got %s", "@ENV:SHARED_DSN", s.DSN)
+	}
+
+	for _, value := range []string{"@VAULT:secret/db", "@ENV:MISSING", "@FILE:" + dir + "/missing", "@handle"} {
+		if os.Setenv("APP_HANDLE", value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+		err := ProcessWithOptions(&s, WithPrefix("app"), WithIndirection())
+		if v, ok := err.(*ParseError); !ok || v.Value != value {
+			t.Errorf("expected ParseError for %s, got %v", value, err)
+		}
+	}
+}
+
+func TestIndirectionRedaction(t *testing.T) {
+	var s struct {
+		Port int `secret:"true" deprecated:"OLD_PORT"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"OLD_PORT": "@ENV:SHARED",
+		"SHARED":   "hunter2",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	err := ProcessWithOptions(&s, WithPrefix("app"), WithIndirection())
+	if v, ok := err.(*ParseError); !ok || v.KeyName != "OLD_PORT" {
+		t.Errorf("expected ParseError for OLD_PORT, got %v", err)
+	} else if strings.Contains(v.Error(), "hunter2") {
+		t.Errorf("expected the secret to be redacted from %q", v.Error())
+	}
+
+	var n struct {
+		Count int `deprecated:"OLD_COUNT"`
+	}
+	if os.Setenv("OLD_COUNT", "@ENV:SHARED") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = ProcessWithOptions(&n, WithPrefix("app"), WithIndirection())
+	if v, ok := err.(*ParseError); !ok || v.Value != "hunter2" {
+		t.Errorf("expected ParseError for the resolved value, got %v", err)
+	}
+}
+
+func TestIndirectionFS(t *testing.T) {
+	var s struct {
+		Password string
+	}
+	os.Clearenv()
+	if os.Setenv("APP_PASSWORD", "@FILE:secrets/password") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	fsys := fstest.MapFS{
+		"secrets/password": {Data: []byte("hunter2\n")},
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithFS(fsys), WithIndirection()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Password != "hunter2" {
+		t.Errorf("expected %s, got %s", "hunter2", s.Password)
+	}
+}
@@ -0,0 +1,1038 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A ConfigFileError occurs when a config file exists but cannot be parsed, when
+// a config file is missing and WithErrorOnMissingFile is used, or when a
+// config URL cannot be fetched.
+type ConfigFileError struct {
+	Path string
+	Err  error
+}
+
+func (e *ConfigFileError) Error() string {
+	return fmt.Sprintf("kkonfig: config file %s: %s", e.Path, e.Err)
+}
+
+func (e *ConfigFileError) Unwrap() error {
+	return e.Err
+}
+
+func processJson(o *options, spec interface{}) error {
+	// Parse potential json files into the specification, after any embedded
+	// documents
+	configs := make([]configInput, 0, len(o.embedded)+len(o.configs))
+	configs = append(configs, o.embedded...)
+	configs = append(configs, o.configs...)
+	for _, config := range configs {
+		if err := o.ctx.Err(); err != nil {
+			return err
+		}
+		var err error
+		switch {
+		case config.reader != nil:
+			err = processJsonReader(o, config.name, "", config.reader, spec, nil)
+		case config.url:
+			err = processJsonURL(o, config.name, config.optional, spec)
+		default:
+			err = processJsonGlob(o, config.name, spec)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return processEnvironmentConfig(o, spec)
+}
+
+// processEnvironmentConfig loads the environment-specific config file set up
+// with WithEnvironmentFrom, if any. Unlike other config files, the file is
+// skipped when it doesn't exist unless config files are required, since not
+// every environment needs one.
+func processEnvironmentConfig(o *options, spec interface{}) error {
+	path, err := o.environmentConfig()
+	if err != nil || path == "" {
+		return err
+	}
+	if !o.requireConfigFiles {
+		if o.fsys != nil {
+			_, err = fs.Stat(o.fsys, path)
+		} else {
+			_, err = os.Stat(path)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+	}
+	return processJsonFile(o, path, spec, nil)
+}
+
+// processJsonGlob loads the config files matching pattern in sorted order. A
+// pattern without glob characters names a single file, and a pattern that
+// matches nothing is skipped.
+func processJsonGlob(o *options, pattern string, spec interface{}) error {
+	paths, err := expandConfigPath(o.fsys, pattern)
+	if err != nil {
+		return &ConfigFileError{Path: pattern, Err: err}
+	}
+	if len(paths) == 0 && o.requireConfigFiles {
+		return &ConfigFileError{Path: pattern, Err: errors.New("pattern matches no files")}
+	}
+	for _, path := range paths {
+		if err := processJsonFile(o, path, spec, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandConfigPath returns the files matching a config path, which may be a
+// glob pattern such as conf.d/*.json. Patterns are matched against fsys when
+// it isn't nil.
+func expandConfigPath(fsys fs.FS, path string) ([]string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+	var paths []string
+	var err error
+	if fsys != nil {
+		paths, err = fs.Glob(fsys, path)
+	} else {
+		paths, err = filepath.Glob(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// jsonHeader holds the keys of a config file that are interpreted by kkonfig
+// itself rather than unmarshaled into the specification.
+type jsonHeader struct {
+	// Base names a config file that is loaded before the current one. A
+	// relative path is resolved against the directory of the current file.
+	Base string `json:"base"`
+}
+
+// processJsonFile unmarshals the json file at path into spec, after first
+// loading the chain of base files it declares. chain holds the files
+// currently being loaded and is used to detect inheritance cycles.
+func processJsonFile(o *options, path string, spec interface{}, chain []string) error {
+	abs := path
+	if o.fsys == nil {
+		if p, err := filepath.Abs(path); err == nil {
+			abs = p
+		}
+	}
+	for _, p := range chain {
+		if p == abs {
+			return fmt.Errorf("kkonfig: base cycle detected: %s -> %s", strings.Join(chain, " -> "), abs)
+		}
+	}
+
+	// files that can't be opened are skipped, so that config files are optional
+	var f io.ReadCloser
+	var err error
+	dir := filepath.Dir(path)
+	if o.fsys != nil {
+		f, err = o.fsys.Open(path)
+		dir = pathpkg.Dir(path)
+	} else {
+		f, err = os.Open(path)
+	}
+	if err != nil {
+		if o.requireConfigFiles || o.errorOnMissingFile && errors.Is(err, fs.ErrNotExist) {
+			return &ConfigFileError{Path: path, Err: err}
+		}
+		return nil
+	}
+	defer f.Close()
+
+	return processJsonReader(o, path, dir, f, spec, append(chain, abs))
+}
+
+// contextReader fails reads from r with ctx.Err() once ctx is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// processJsonReader unmarshals the json document read from r into spec. name
+// identifies the document in errors, and a relative path of its base file is
+// resolved against dir.
+func processJsonReader(o *options, name, dir string, r io.Reader, spec interface{}, chain []string) error {
+	jsonBytes, err := ioutil.ReadAll(contextReader{ctx: o.ctx, r: r})
+	if err != nil {
+		if ctxErr := o.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return &ConfigFileError{Path: name, Err: err}
+	}
+	if strings.HasSuffix(name, ".gz") || bytes.HasPrefix(jsonBytes, gzipMagic) {
+		if jsonBytes, err = gunzip(jsonBytes); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+	}
+	jsonBytes, err = toJson(o, strings.TrimSuffix(name, ".gz"), jsonBytes)
+	if err != nil {
+		return &ConfigFileError{Path: name, Err: err}
+	}
+	if o.dottedKeys {
+		if jsonBytes, err = expandDottedKeys(jsonBytes); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+	}
+
+	var header jsonHeader
+	if err := json.Unmarshal(jsonBytes, &header); err != nil {
+		return &ConfigFileError{Path: name, Err: err}
+	}
+
+	if header.Base != "" {
+		base := header.Base
+		if o.fsys != nil && !strings.HasPrefix(base, "/") {
+			base = pathpkg.Join(dir, base)
+		} else if o.fsys == nil && !filepath.IsAbs(base) {
+			base = filepath.Join(dir, base)
+		}
+		if err := processJsonFile(o, base, spec, chain); err != nil {
+			return err
+		}
+	}
+
+	if o.jsonRoot != "" {
+		// the header belongs to the whole document rather than the subtree
+		var found bool
+		if jsonBytes, found, err = jsonSubtree(jsonBytes, o.jsonRoot); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+		if !found {
+			if o.requireJsonRoot {
+				return &ConfigFileError{Path: name, Err: fmt.Errorf("missing root %s", o.jsonRoot)}
+			}
+			return nil
+		}
+	} else {
+		// the header isn't part of the specification
+		if jsonBytes, err = withoutJsonKey(jsonBytes, "base"); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+	}
+	if o.caseSensitiveJson {
+		if jsonBytes, err = exactJsonKeys(o, jsonBytes, reflect.TypeOf(spec)); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+	}
+	if o.trimSpace {
+		if jsonBytes, err = trimJsonStrings(jsonBytes); err != nil {
+			return &ConfigFileError{Path: name, Err: err}
+		}
+	}
+	jsonBytes, _ = withoutIgnoredJsonKeys(o, jsonBytes, reflect.TypeOf(spec))
+	jsonBytes, _ = coerceJsonScalars(jsonBytes, reflect.TypeOf(spec))
+	if err := mergeJson(o, jsonBytes, reflect.ValueOf(spec)); err != nil {
+		return &ConfigFileError{Path: name, Err: err}
+	}
+	if o.onFileLoaded != nil {
+		o.onFileLoaded(name)
+	}
+	present := make(map[string]bool)
+	markJsonPresence(o, jsonBytes, reflect.TypeOf(spec), "", present)
+	paths := make([]string, 0, len(present))
+	for p := range present {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		o.setOrigin(p, Origin{Source: SourceFile, Location: name})
+	}
+	return checkJsonOneOf(o, name, spec, present)
+}
+
+// checkJsonOneOf applies the `oneof` tags of the fields the config file name
+// set, like processField does for the values of other sources, replacing
+// aliases with the values they stand for.
+func checkJsonOneOf(o *options, name string, spec interface{}, present map[string]bool) error {
+	for _, info := range gatherInfo(o, o.prefix, spec) {
+		if !present[info.Path] || info.Tags.Get("oneof") == "" {
+			continue
+		}
+		if err := matchOneOfValue(info.Field, info.Tags); err != nil {
+			return &ConfigFileError{Path: name, Err: fmt.Errorf("%s: %w", info.Path, err)}
+		}
+	}
+	return nil
+}
+
+// matchOneOfValue checks a decoded value against the `oneof` tag with
+// matchOneOf. Like processField, it checks the elements of slices and the keys
+// and values of maps one by one.
+func matchOneOfValue(v reflect.Value, tag reflect.StructTag) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return matchOneOfValue(v.Elem(), tag)
+	case reflect.String:
+		value, err := matchOneOf(v.String(), tag)
+		if err != nil {
+			return err
+		}
+		v.SetString(value)
+		return nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := matchOneOfValue(v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		for _, key := range v.MapKeys() {
+			k := reflect.New(key.Type()).Elem()
+			k.Set(key)
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := matchOneOfValue(k, tag); err != nil {
+				return err
+			}
+			if err := matchOneOfValue(elem, tag); err != nil {
+				return err
+			}
+			m.SetMapIndex(k, elem)
+		}
+		v.Set(m)
+		return nil
+	}
+	_, err := matchOneOf(formatField(v, tag), tag)
+	return err
+}
+
+// trimJsonStrings trims leading and trailing whitespace from the string values
+// of the json document data. Keys are left alone.
+func trimJsonStrings(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(trimJsonValue(doc))
+}
+
+func trimJsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = trimJsonValue(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = trimJsonValue(v[key])
+		}
+	}
+	return v
+}
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// gunzip decompresses a gzipped config, such as config.json.gz
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	defer zr.Close()
+	data, err = ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("decompressing: %w", err)
+	}
+	return data, nil
+}
+
+// mergeJson unmarshals data onto the value ptr points to, layering it over
+// what earlier layers set: nested objects are merged field by field, including
+// struct values of maps, while arrays replace slices wholesale.
+func mergeJson(o *options, data []byte, ptr reflect.Value) error {
+	var m jsonMerge
+	prepareJsonMerge(o, data, ptr.Elem(), &m)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if o.disallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if o.useNumber {
+		dec.UseNumber()
+	}
+	if err := dec.Decode(ptr.Interface()); err != nil {
+		return err
+	}
+
+	// encoding/json replaces map values, so merge the document onto a copy of
+	// the previous value instead
+	for _, e := range m.entries {
+		merged := reflect.New(e.old.Type())
+		merged.Elem().Set(e.old)
+		if err := mergeJson(o, e.raw, merged); err != nil {
+			return err
+		}
+		e.m.SetMapIndex(e.key, merged.Elem())
+	}
+	return nil
+}
+
+// expandDottedKeys turns the dotted top-level keys of the json object data into
+// nested objects, so {"database.host": "x"} becomes {"database": {"host":
+// "x"}}. Keys are expanded in sorted order and merged with objects given under
+// plain keys, so a dotted key overrides the same field of a nested object.
+func expandDottedKeys(data []byte) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(obj))
+	dotted := false
+	for key := range obj {
+		keys = append(keys, key)
+		dotted = dotted || strings.Contains(key, ".")
+	}
+	if !dotted {
+		return data, nil
+	}
+	sort.Strings(keys)
+
+	tree := make(map[string]interface{}, len(obj))
+	for _, key := range keys {
+		if err := setDottedKey(tree, strings.Split(key, "."), obj[key]); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key, err)
+		}
+	}
+	return json.Marshal(tree)
+}
+
+// setDottedKey assigns raw to the key path in tree, whose nested objects are
+// either still raw or already expanded into maps.
+func setDottedKey(tree map[string]interface{}, path []string, raw json.RawMessage) error {
+	key := path[0]
+	sub, expanded := tree[key].(map[string]interface{})
+	if len(path) == 1 && !expanded {
+		tree[key] = raw
+		return nil
+	}
+
+	if !expanded {
+		sub = make(map[string]interface{})
+		if existing, ok := tree[key].(json.RawMessage); ok {
+			var obj map[string]json.RawMessage
+			if err := json.Unmarshal(existing, &obj); err != nil || obj == nil {
+				return fmt.Errorf("%s is not an object", key)
+			}
+			for k, v := range obj {
+				sub[k] = v
+			}
+		}
+		tree[key] = sub
+	}
+	if len(path) > 1 {
+		return setDottedKey(sub, path[1:], raw)
+	}
+
+	// an object under a plain key is merged into what dotted keys set
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil || obj == nil {
+		return fmt.Errorf("%s is not an object", key)
+	}
+	for k, v := range obj {
+		if err := setDottedKey(sub, []string{k}, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonSubtree returns the object found under root in the json object data,
+// where root is a key or a dotted path of keys such as services.myservice.
+// It reports false if there is nothing under root.
+func jsonSubtree(data []byte, root string) ([]byte, bool, error) {
+	for _, key := range strings.Split(root, ".") {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, false, err
+		}
+		raw, ok := obj[key]
+		if !ok || string(raw) == "null" {
+			return nil, false, nil
+		}
+		data = raw
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return nil, false, fmt.Errorf("root %s is not an object", root)
+	}
+	return data, true, nil
+}
+
+// withoutJsonKey removes key from the json object data. Like encoding/json,
+// keys are matched case-insensitively.
+func withoutJsonKey(data []byte, key string) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	found := false
+	for k := range obj {
+		if strings.EqualFold(k, key) {
+			delete(obj, k)
+			found = true
+		}
+	}
+	if !found {
+		return data, nil
+	}
+	return json.Marshal(obj)
+}
+
+// exactJsonKeys removes the keys of the json document data that only match a
+// field of t when compared case-insensitively, so that encoding/json ignores
+// them like unknown keys. With WithDisallowUnknownFields they are an error
+// instead.
+func exactJsonKeys(o *options, data []byte, t reflect.Type) ([]byte, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if customJsonUnmarshaler(reflect.New(t)) {
+		return data, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil || obj == nil {
+			return data, nil
+		}
+		fields := make(map[string]reflect.Type)
+		collectJsonFields(t, fields)
+		for key, raw := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				for name := range fields {
+					if strings.EqualFold(name, key) {
+						if o.disallowUnknownFields {
+							return nil, fmt.Errorf("json: unknown field %q", key)
+						}
+						delete(obj, key)
+						break
+					}
+				}
+				continue
+			}
+			exact, err := exactJsonKeys(o, raw, ft)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = exact
+		}
+		return json.Marshal(obj)
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if t.Elem().Kind() == reflect.Uint8 || json.Unmarshal(data, &elems) != nil {
+			return data, nil
+		}
+		for i, raw := range elems {
+			exact, err := exactJsonKeys(o, raw, t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = exact
+		}
+		return json.Marshal(elems)
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return data, nil
+		}
+		for key, raw := range obj {
+			exact, err := exactJsonKeys(o, raw, t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = exact
+		}
+		return json.Marshal(obj)
+	}
+	return data, nil
+}
+
+// coerceJsonScalars rewrites the numbers and booleans of the json document
+// data that are decoded into string fields as strings holding their text, so
+// that {"Port": 8080} sets a string field Port to "8080" rather than failing.
+// It reports whether anything was rewritten.
+func coerceJsonScalars(data []byte, t reflect.Type) ([]byte, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if customJsonUnmarshaler(reflect.New(t)) {
+		return data, false
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		text := bytes.TrimSpace(data)
+		if len(text) == 0 {
+			return data, false
+		}
+		if c := text[0]; c == '-' || c >= '0' && c <= '9' || string(text) == "true" || string(text) == "false" {
+			coerced, err := json.Marshal(string(text))
+			return coerced, err == nil
+		}
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil || obj == nil {
+			return data, false
+		}
+		fields := make(map[string]reflect.Type)
+		collectJsonFields(t, fields)
+		changed := false
+		for key, raw := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				for name, nt := range fields {
+					if strings.EqualFold(name, key) {
+						ft, ok = nt, true
+						break
+					}
+				}
+			}
+			if ok {
+				var c bool
+				if obj[key], c = coerceJsonScalars(raw, ft); c {
+					changed = true
+				}
+			}
+		}
+		if changed {
+			return marshalCoerced(data, obj)
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if t.Elem().Kind() == reflect.Uint8 || json.Unmarshal(data, &elems) != nil {
+			return data, false
+		}
+		changed := false
+		for i, raw := range elems {
+			var c bool
+			if elems[i], c = coerceJsonScalars(raw, t.Elem()); c {
+				changed = true
+			}
+		}
+		if changed {
+			return marshalCoerced(data, elems)
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return data, false
+		}
+		changed := false
+		for key, raw := range obj {
+			var c bool
+			if obj[key], c = coerceJsonScalars(raw, t.Elem()); c {
+				changed = true
+			}
+		}
+		if changed {
+			return marshalCoerced(data, obj)
+		}
+	}
+	return data, false
+}
+
+// withoutIgnoredJsonKeys removes the keys of the json document data that would
+// be decoded into ignored fields of t, wherever they are nested, including
+// elements of slices and values of maps. It reports whether anything was
+// removed.
+func withoutIgnoredJsonKeys(o *options, data []byte, t reflect.Type) ([]byte, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if customJsonUnmarshaler(reflect.New(t)) {
+		return data, false
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil || obj == nil {
+			return data, false
+		}
+		fields := make(map[string]reflect.Type)
+		collectJsonFields(t, fields)
+		changed := deleteIgnoredJsonKeys(o, obj, t, fields)
+		for key, raw := range obj {
+			ft, ok := fields[key]
+			if !ok {
+				for name, nt := range fields {
+					if strings.EqualFold(name, key) {
+						ft, ok = nt, true
+						break
+					}
+				}
+			}
+			if ok {
+				var c bool
+				if obj[key], c = withoutIgnoredJsonKeys(o, raw, ft); c {
+					changed = true
+				}
+			}
+		}
+		if changed {
+			return marshalCoerced(data, obj)
+		}
+	case reflect.Slice, reflect.Array:
+		var elems []json.RawMessage
+		if t.Elem().Kind() == reflect.Uint8 || json.Unmarshal(data, &elems) != nil {
+			return data, false
+		}
+		changed := false
+		for i, raw := range elems {
+			var c bool
+			if elems[i], c = withoutIgnoredJsonKeys(o, raw, t.Elem()); c {
+				changed = true
+			}
+		}
+		if changed {
+			return marshalCoerced(data, elems)
+		}
+	case reflect.Map:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return data, false
+		}
+		changed := false
+		for key, raw := range obj {
+			var c bool
+			if obj[key], c = withoutIgnoredJsonKeys(o, raw, t.Elem()); c {
+				changed = true
+			}
+		}
+		if changed {
+			return marshalCoerced(data, obj)
+		}
+	}
+	return data, false
+}
+
+// deleteIgnoredJsonKeys deletes the keys of the json object obj that name an
+// ignored field of the struct type t or of the structs it embeds, where fields
+// holds the json fields of the outermost struct. It reports whether anything
+// was deleted.
+func deleteIgnoredJsonKeys(o *options, obj map[string]json.RawMessage, t reflect.Type, fields map[string]reflect.Type) bool {
+	deleted := false
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		name := ftype.Name
+		if tag := strings.Split(ftype.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		} else if ftype.Anonymous {
+			et := ftype.Type
+			for et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				if !isIgnored(o, ftype) {
+					deleted = deleteIgnoredJsonKeys(o, obj, et, fields) || deleted
+					continue
+				}
+				// the fields of an ignored embedded struct are promoted
+				// unless the embedding struct has one of the same name
+				own := make(map[string]reflect.Type)
+				collectJsonFields(t, own)
+				promoted := make(map[string]reflect.Type)
+				collectJsonFields(et, promoted)
+				for pname, pt := range promoted {
+					if own[pname] == pt {
+						deleted = deleteJsonKey(obj, pname, fields) || deleted
+					}
+				}
+				continue
+			}
+		}
+		if isIgnored(o, ftype) {
+			deleted = deleteJsonKey(obj, name, fields) || deleted
+		}
+	}
+	return deleted
+}
+
+// deleteJsonKey deletes the keys of the json object obj that encoding/json
+// would decode into the field name, which are compared case-insensitively
+// unless they exactly name another of fields. It reports whether anything was
+// deleted.
+func deleteJsonKey(obj map[string]json.RawMessage, name string, fields map[string]reflect.Type) bool {
+	deleted := false
+	for key := range obj {
+		if _, other := fields[key]; key == name || strings.EqualFold(key, name) && !other {
+			delete(obj, key)
+			deleted = true
+		}
+	}
+	return deleted
+}
+
+// marshalCoerced encodes the rewritten value v of the json document data,
+// keeping data if that fails.
+func marshalCoerced(data []byte, v interface{}) ([]byte, bool) {
+	coerced, err := json.Marshal(v)
+	if err != nil {
+		return data, false
+	}
+	return coerced, true
+}
+
+// collectJsonFields adds the json names of the fields of the struct type t to
+// fields, along with their types. Fields of embedded structs are promoted
+// unless a shallower field has the same name.
+func collectJsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		name := ftype.Name
+		if tag := strings.Split(ftype.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		} else if ftype.Anonymous {
+			et := ftype.Type
+			for et.Kind() == reflect.Ptr {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				embedded = append(embedded, et)
+				continue
+			}
+		}
+		if ftype.PkgPath != "" {
+			continue
+		}
+		fields[name] = ftype.Type
+	}
+
+	for _, et := range embedded {
+		promoted := make(map[string]reflect.Type)
+		collectJsonFields(et, promoted)
+		for name, ft := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+}
+
+// jsonMerge holds what is needed to undo the parts of unmarshaling a json
+// document that encoding/json does differently from a merge.
+type jsonMerge struct {
+	entries []jsonMapEntry
+}
+
+// jsonMapEntry is a map value that existed before a json document that also
+// contains it was unmarshaled.
+type jsonMapEntry struct {
+	m, key, old reflect.Value
+	raw         json.RawMessage
+}
+
+// prepareJsonMerge walks the json object data alongside v before it is
+// unmarshaled. Slices the document contains are cleared, as encoding/json
+// would otherwise decode into their stale elements, and existing struct map
+// values it contains are collected.
+func prepareJsonMerge(o *options, data []byte, v reflect.Value, m *jsonMerge) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !v.CanSet() {
+				return
+			}
+			// allocate what encoding/json would, so that its fields can be
+			// walked too
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if !v.CanSet() || customJsonUnmarshaler(v.Addr()) {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.Zero(v.Type()))
+	case reflect.Map:
+		if v.IsNil() || v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		elem := v.Type().Elem()
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct && elem.Kind() != reflect.Map {
+			return
+		}
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return
+		}
+		for k, raw := range obj {
+			key := reflect.ValueOf(k).Convert(v.Type().Key())
+			if old := v.MapIndex(key); old.IsValid() && string(raw) != "null" {
+				m.entries = append(m.entries, jsonMapEntry{m: v, key: key, old: old, raw: raw})
+			}
+		}
+	case reflect.Struct:
+		var obj map[string]json.RawMessage
+		if json.Unmarshal(data, &obj) != nil {
+			return
+		}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			ftype := t.Field(i)
+			if isIgnored(o, ftype) {
+				continue
+			}
+
+			name := ftype.Name
+			if tag := strings.Split(ftype.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			} else if ftype.Anonymous {
+				prepareJsonMerge(o, data, v.Field(i), m)
+				continue
+			}
+			if ftype.PkgPath != "" {
+				continue
+			}
+
+			if raw, ok := lookupJsonKey(obj, name); ok && string(raw) != "null" {
+				prepareJsonMerge(o, raw, v.Field(i), m)
+			}
+		}
+	}
+}
+
+// customJsonUnmarshaler reports whether encoding/json hands the value ptr
+// points to over to its own unmarshal method.
+func customJsonUnmarshaler(ptr reflect.Value) bool {
+	switch ptr.Interface().(type) {
+	case json.Unmarshaler, encoding.TextUnmarshaler:
+		return true
+	}
+	return false
+}
+
+// markJsonPresence records the paths of the fields of t that are explicitly
+// given a value in the json object data, so that an explicit zero value can be
+// told apart from an absent key. Keys are matched to fields like
+// encoding/json does, and null values don't count as present.
+func markJsonPresence(o *options, data []byte, t reflect.Type, parent string, set map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		// the elements of slices of structs are walked by index
+		var elems []json.RawMessage
+		if t.Elem().Kind() == reflect.Uint8 || json.Unmarshal(data, &elems) != nil {
+			return
+		}
+		for i, raw := range elems {
+			markJsonPresence(o, raw, t.Elem(), fmt.Sprintf("%s[%d]", parent, i), set)
+		}
+		return
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		if isIgnored(o, ftype) {
+			continue
+		}
+		name := ftype.Name
+		if tag := strings.Split(ftype.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		} else if ftype.Anonymous {
+			// fields of embedded structs are promoted
+			markJsonPresence(o, data, ftype.Type, parent, set)
+			continue
+		}
+		if ftype.PkgPath != "" {
+			continue
+		}
+
+		raw, ok := lookupJsonKey(obj, name)
+		if !ok || string(raw) == "null" {
+			continue
+		}
+
+		path := ftype.Name
+		if parent != "" {
+			path = parent + "." + path
+		}
+		set[path] = true
+		markJsonPresence(o, raw, ftype.Type, path, set)
+	}
+}
+
+// lookupJsonKey finds the value for a field name in a json object, preferring
+// an exact match over a case-insensitive one like encoding/json does.
+func lookupJsonKey(obj map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	if raw, ok := obj[name]; ok {
+		return raw, true
+	}
+	for key, raw := range obj {
+		if strings.EqualFold(key, name) {
+			return raw, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,790 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+type presenceEmbedded struct {
+	Region string
+}
+
+type presenceSpecification struct {
+	presenceEmbedded
+	Retries  int
+	Timeout  int    `json:"timeout_seconds"`
+	Skipped  string `json:"-"`
+	Database *struct {
+		Host string
+		Port int
+	}
+	Missing string
+	Null    *int
+}
+
+func TestJsonPresence(t *testing.T) {
+	data := []byte(`{
+		"region": "eu",
+		"Retries": 0,
+		"timeout_seconds": 0,
+		"Skipped": "x",
+		"database": {"Port": 0},
+		"Null": null
+	}`)
+	set := make(map[string]bool)
+	markJsonPresence(newOptions(nil), data, reflect.TypeOf(&presenceSpecification{}), "", set)
+
+	expected := map[string]bool{
+		"Region":        true,
+		"Retries":       true,
+		"Timeout":       true,
+		"Database":      true,
+		"Database.Port": true,
+	}
+	if !reflect.DeepEqual(set, expected) {
+		t.Errorf("expected %v, got %v", expected, set)
+	}
+}
+
+func TestRequiredExplicitZero(t *testing.T) {
+	type spec struct {
+		Retries int `required:"true"`
+	}
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	zero := writeConfigFile(t, dir, "zero.json", `{"Retries": 0}`)
+	absent := writeConfigFile(t, dir, "absent.json", `{}`)
+
+	os.Clearenv()
+	var s spec
+	if err := Process("env_config", []string{absent}, &s); err == nil {
+		t.Error("expected an error when no layer sets the field")
+	}
+
+	s = spec{}
+	if err := Process("env_config", []string{zero}, &s); err != nil {
+		t.Errorf("expected an explicit zero in json to count as set, got %s", err)
+	}
+
+	s = spec{}
+	if os.Setenv("ENV_CONFIG_RETRIES", "0") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", []string{absent}, &s); err != nil {
+		t.Errorf("expected an explicit zero in the environment to count as set, got %s", err)
+	}
+
+	os.Clearenv()
+	var d struct {
+		Retries int `required:"true" default:"0"`
+	}
+	if err := Process("env_config", nil, &d); err != nil {
+		t.Errorf("expected an explicit zero default to count as set, got %s", err)
+	}
+}
+
+func TestConfigFileError(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	valid := writeConfigFile(t, dir, "valid.json", `{"Host": "localhost"}`)
+	trailingComma := writeConfigFile(t, dir, "trailing.json", `{"Host": "prod",}`)
+	wrongType := writeConfigFile(t, dir, "type.json", `{"Port": "eighty"}`)
+	missing := dir + "/missing.json"
+
+	if err := Process("env_config", []string{missing, valid}, &s); err != nil {
+		t.Errorf("expected a missing file to be skipped, got %s", err)
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+
+	err = Process("env_config", []string{valid, trailingComma}, &s)
+	v, ok := err.(*ConfigFileError)
+	if !ok {
+		t.Fatalf("expected ConfigFileError, got %v", err)
+	}
+	if v.Path != trailingComma {
+		t.Errorf("expected %s, got %s", trailingComma, v.Path)
+	}
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected a json.SyntaxError, got %v", v.Err)
+	}
+
+	err = Process("env_config", []string{wrongType}, &s)
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("expected a json.UnmarshalTypeError, got %v", err)
+	}
+}
+
+func TestProcessReaders(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_USER", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	readers := []io.Reader{
+		strings.NewReader(`{"Host": "localhost", "Port": 80, "User": "json"}`),
+		bytes.NewBufferString(`{"Port": 8080}`),
+	}
+	if err := ProcessReaders("env_config", readers, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "env" {
+		t.Errorf("expected %s, got %s", "env", s.User)
+	}
+
+	err := ProcessReaders("env_config", []io.Reader{strings.NewReader(`{`)}, &s)
+	v, ok := err.(*ConfigFileError)
+	if !ok {
+		t.Fatalf("expected ConfigFileError, got %v", err)
+	}
+	if v.Path != "reader 1" {
+		t.Errorf("expected %s, got %s", "reader 1", v.Path)
+	}
+}
+
+func TestWithConfigBytes(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"User": "file"}`)
+	err = ProcessWithOptions(&s,
+		WithConfigPaths(path),
+		WithConfigBytes([]byte(`{"Host": "localhost", "Port": 80, "User": "embedded"}`)),
+		WithConfigBytes([]byte(`{"Port": 8080}`)),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "file" {
+		t.Errorf("expected %s, got %s", "file", s.User)
+	}
+}
+
+func TestConfigPathGlobs(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "conf.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, dir, "conf.d/20-port.json", `{"Port": 8080, "User": "port"}`)
+	writeConfigFile(t, dir, "conf.d/10-host.json", `{"Host": "localhost", "Port": 80}`)
+	writeConfigFile(t, dir, "conf.d/notes.txt", `not json`)
+	path := writeConfigFile(t, dir, "local.json", `{"User": "local"}`)
+
+	err = Process("", []string{filepath.Join(dir, "conf.d", "*.json"), path, filepath.Join(dir, "missing.d", "*.json")}, &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "local" {
+		t.Errorf("expected %s, got %s", "local", s.User)
+	}
+
+	err = Process("", []string{filepath.Join(dir, "conf.d", "[*.json")}, &s)
+	var fileErr *ConfigFileError
+	if !errors.As(err, &fileErr) || !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("expected ConfigFileError for a malformed pattern, got %v", err)
+	}
+}
+
+func TestWithDottedKeys(t *testing.T) {
+	type database struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+		User string `json:"user"`
+	}
+	var s struct {
+		Name     string            `json:"name"`
+		Database database          `json:"database"`
+		Replica  *database         `json:"replica"`
+		Labels   map[string]string `json:"labels"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{
+		"name": "app",
+		"database": {"host": "nested", "user": "admin"},
+		"database.host": "dotted",
+		"database.port": 5432,
+		"replica.host": "replica",
+		"labels.env": "prod"
+	}`)
+	if err := ProcessWithOptions(&s, WithConfigPaths(path), WithDottedKeys()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Name != "app" {
+		t.Errorf("expected %s, got %s", "app", s.Name)
+	}
+	if expected := (database{Host: "dotted", Port: 5432, User: "admin"}); s.Database != expected {
+		t.Errorf("expected %+v, got %+v", expected, s.Database)
+	}
+	if s.Replica == nil || s.Replica.Host != "replica" {
+		t.Errorf("expected %s, got %+v", "replica", s.Replica)
+	}
+	if s.Labels["env"] != "prod" {
+		t.Errorf("expected %s, got %v", "prod", s.Labels)
+	}
+
+	path = writeConfigFile(t, dir, "conflict.json", `{"name": "app", "name.first": "x"}`)
+	err = ProcessWithOptions(&s, WithConfigPaths(path), WithDottedKeys())
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError, got %v", err)
+	}
+}
+
+func TestWithCaseSensitiveJSON(t *testing.T) {
+	type server struct {
+		Host string
+	}
+	var s struct {
+		Name    string `json:"name"`
+		NAME    string
+		Primary server
+		Servers []server
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{
+		"Name": "wrong",
+		"NAME": "upper",
+		"primary": {"Host": "wrong"},
+		"Servers": [{"Host": "a"}, {"host": "wrong"}]
+	}`)
+	if err := ProcessWithOptions(&s, WithConfigPaths(path), WithCaseSensitiveJSON()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Name != "" {
+		t.Errorf("expected %q, got %q", "", s.Name)
+	}
+	if s.NAME != "upper" {
+		t.Errorf("expected %s, got %s", "upper", s.NAME)
+	}
+	if s.Primary.Host != "" {
+		t.Errorf("expected %q, got %q", "", s.Primary.Host)
+	}
+	if expected := []server{{Host: "a"}, {}}; !reflect.DeepEqual(s.Servers, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Servers)
+	}
+
+	err = ProcessWithOptions(&s, WithConfigPaths(path), WithCaseSensitiveJSON(), WithDisallowUnknownFields())
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError, got %v", err)
+	}
+}
+
+func TestJsonScalarsIntoStrings(t *testing.T) {
+	var s struct {
+		Port    string
+		Debug   string
+		Version *string
+		Ports   []string
+		Labels  map[string]string
+		Count   int
+		Nested  struct {
+			ID string `json:"id"`
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{
+		"port": 8080,
+		"Debug": true,
+		"Version": 1.10,
+		"Ports": [80, "443"],
+		"Labels": {"replicas": 3, "tier": "web"},
+		"Count": 2,
+		"Nested": {"ID": -1}
+	}`)
+	if err := Process("", []string{path}, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Port != "8080" {
+		t.Errorf("expected %s, got %s", "8080", s.Port)
+	}
+	if s.Debug != "true" {
+		t.Errorf("expected %s, got %s", "true", s.Debug)
+	}
+	if s.Version == nil || *s.Version != "1.10" {
+		t.Errorf("expected %s, got %v", "1.10", s.Version)
+	}
+	if expected := []string{"80", "443"}; !reflect.DeepEqual(s.Ports, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Ports)
+	}
+	if expected := map[string]string{"replicas": "3", "tier": "web"}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Labels)
+	}
+	if s.Count != 2 {
+		t.Errorf("expected %d, got %d", 2, s.Count)
+	}
+	if s.Nested.ID != "-1" {
+		t.Errorf("expected %s, got %s", "-1", s.Nested.ID)
+	}
+
+	path = writeConfigFile(t, dir, "invalid.json", `{"Port": {"number": 8080}}`)
+	if _, ok := Process("", []string{path}, &s).(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError")
+	}
+}
+
+func TestGzippedConfigFiles(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	gzipped := func(data string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	compressed := writeConfigFile(t, dir, "config.json.gz", gzipped(`{"Host": "localhost"}`))
+	sniffed := writeConfigFile(t, dir, "snapshot", gzipped(`{"Port": 8080}`))
+	if err := Process("", []string{compressed, sniffed}, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	corrupt := writeConfigFile(t, dir, "corrupt.json.gz", gzipped(`{"Port": 80}`)[:12])
+	err = Process("", []string{corrupt}, &s)
+	if _, ok := err.(*ConfigFileError); !ok || !strings.Contains(err.Error(), "decompressing") {
+		t.Errorf("expected ConfigFileError for a corrupt gzip stream, got %v", err)
+	}
+}
+
+func TestProcessFS(t *testing.T) {
+	var s struct {
+		Host  string
+		Port  int
+		Debug bool
+	}
+	os.Clearenv()
+	fsys := fstest.MapFS{
+		"config/base.json":         {Data: []byte(`{"Host": "localhost", "Port": 80}`)},
+		"config/app.json":          {Data: []byte(`{"base": "base.json", "Port": 8080}`)},
+		"config/conf.d/debug.json": {Data: []byte(`{"Debug": true}`)},
+	}
+	if err := ProcessFS(fsys, "", []string{"config/app.json", "config/conf.d/*.json", "missing.json"}, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if !s.Debug {
+		t.Errorf("expected %t, got %t", true, s.Debug)
+	}
+
+	err := ProcessWithOptions(&s, WithFS(fsys), WithConfigPaths("missing.json"), WithErrorOnMissingFile())
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError for a missing file, got %v", err)
+	}
+}
+
+func TestJsonNumbers(t *testing.T) {
+	var s struct {
+		ID       int64
+		Serial   uint64
+		Exact    json.Number
+		Settings map[string]interface{}
+	}
+	os.Clearenv()
+	// 2^53 + 1 can't be represented as a float64
+	data := `{"ID": 9007199254740993, "Serial": 18446744073709551615, "Exact": 9007199254740993, "Settings": {"id": 9007199254740993}}`
+	err := ProcessWithOptions(&s, WithConfigReaders(strings.NewReader(data)), WithUseNumber())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.ID != 9007199254740993 {
+		t.Errorf("expected %d, got %d", int64(9007199254740993), s.ID)
+	}
+	if s.Serial != 18446744073709551615 {
+		t.Errorf("expected %d, got %d", uint64(18446744073709551615), s.Serial)
+	}
+	if s.Exact != "9007199254740993" {
+		t.Errorf("expected %s, got %s", "9007199254740993", s.Exact)
+	}
+	if id := s.Settings["id"]; id != json.Number("9007199254740993") {
+		t.Errorf("expected %s, got %#v", "9007199254740993", id)
+	}
+
+	if os.Setenv("EXACT", "1.5e300") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Exact != "1.5e300" {
+		t.Errorf("expected %s, got %s", "1.5e300", s.Exact)
+	}
+	if os.Setenv("EXACT", "12abc") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if v, ok := Process("", nil, &s).(*ParseError); !ok || !v.IsSyntax() {
+		t.Errorf("expected a syntax ParseError")
+	}
+}
+
+func TestWithJSONRoot(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeConfigFile(t, dir, "base.json", `{"services": {"api": {"Host": "localhost", "Port": 80}}}`)
+	shared := writeConfigFile(t, dir, "shared.json", `{
+		"base": "base.json",
+		"services": {
+			"api": {"Port": 8080},
+			"worker": {"Port": 9090}
+		}
+	}`)
+	other := writeConfigFile(t, dir, "other.json", `{"unrelated": {"Port": 1}}`)
+
+	err = ProcessWithOptions(&s, WithConfigPaths(shared, other), WithJSONRoot("services.api"), WithDisallowUnknownFields())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	err = ProcessWithOptions(&s, WithConfigPaths(other), WithRequiredJSONRoot("services.api"))
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError for a missing root, got %v", err)
+	}
+	err = ProcessWithOptions(&s, WithConfigReaders(strings.NewReader(`{"api": 5}`)), WithJSONRoot("api"))
+	if _, ok := err.(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError for a root that isn't an object, got %v", err)
+	}
+}
+
+func TestOpaqueJsonFields(t *testing.T) {
+	var s struct {
+		Extra    interface{} `default:"ignored"`
+		Raw      json.RawMessage
+		Handlers map[string]interface{}
+		Host     string
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_EXTRA": "from env",
+		"ENV_CONFIG_RAW":   "e30=",
+		"ENV_CONFIG_HOST":  "env",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{
+		"Extra": {"plugins": ["a", "b"], "depth": {"level": 2}},
+		"Raw": {"opaque": true},
+		"Handlers": {"log": {"level": "debug"}}
+	}`)
+	if err := Process("env_config", []string{path}, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := map[string]interface{}{
+		"plugins": []interface{}{"a", "b"},
+		"depth":   map[string]interface{}{"level": float64(2)},
+	}
+	if !reflect.DeepEqual(s.Extra, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Extra)
+	}
+	if string(s.Raw) != `{"opaque": true}` {
+		t.Errorf("expected %s, got %s", `{"opaque": true}`, s.Raw)
+	}
+	if s.Handlers["log"] == nil {
+		t.Errorf("expected the log handler, got %v", s.Handlers)
+	}
+	if s.Host != "env" {
+		t.Errorf("expected %s, got %s", "env", s.Host)
+	}
+	if keys := Keys("env_config", &s); !reflect.DeepEqual(keys, []string{"ENV_CONFIG_HANDLERS", "ENV_CONFIG_HOST"}) {
+		t.Errorf("expected opaque fields to be skipped, got %v", keys)
+	}
+}
+
+func TestJsonDeepMerge(t *testing.T) {
+	type endpoint struct {
+		URL     string
+		Retries int
+	}
+	type server struct {
+		Name  string
+		Ports []int
+	}
+	var s struct {
+		Database struct {
+			Host string
+			Port int
+		}
+		Servers   []server
+		Endpoints map[string]endpoint
+		Limits    map[string]int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := writeConfigFile(t, dir, "base.json", `{
+		"Database": {"Host": "localhost", "Port": 5432},
+		"Servers": [{"Name": "a", "Ports": [80, 443]}, {"Name": "b"}],
+		"Endpoints": {"api": {"URL": "http://api", "Retries": 3}},
+		"Limits": {"cpu": 1, "memory": 512}
+	}`)
+	override := writeConfigFile(t, dir, "override.json", `{
+		"Database": {"Host": "db.internal"},
+		"Servers": [{"Name": "c"}],
+		"Endpoints": {"api": {"URL": "https://api"}},
+		"Limits": {"memory": 1024}
+	}`)
+	if err := Process("env_config", []string{base, override}, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if s.Database.Host != "db.internal" || s.Database.Port != 5432 {
+		t.Errorf("expected %s:%d, got %s:%d", "db.internal", 5432, s.Database.Host, s.Database.Port)
+	}
+	if len(s.Servers) != 1 || s.Servers[0].Name != "c" || s.Servers[0].Ports != nil {
+		t.Errorf("expected %v, got %v", []server{{Name: "c"}}, s.Servers)
+	}
+	if e := s.Endpoints["api"]; e.URL != "https://api" || e.Retries != 3 {
+		t.Errorf("expected %v, got %v", endpoint{"https://api", 3}, e)
+	}
+	if s.Limits["cpu"] != 1 || s.Limits["memory"] != 1024 {
+		t.Errorf("expected %v, got %v", map[string]int{"cpu": 1, "memory": 1024}, s.Limits)
+	}
+}
+
+func TestIgnoredJsonFields(t *testing.T) {
+	type internal struct {
+		Computed string `ignored:"true"`
+		Name     string
+	}
+	type Hidden struct {
+		Salt string
+	}
+	var s struct {
+		Hidden   `ignored:"true"`
+		Host     string
+		Checksum string  `ignored:"true"`
+		Token    *string `envconfig:"-"`
+		Inner    *internal
+		Servers  []internal
+		Named    map[string]internal
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{
+		"Host": "localhost",
+		"Salt": "forged",
+		"Checksum": "forged",
+		"Token": "forged",
+		"Inner": {"Computed": "forged", "Name": "inner"},
+		"Servers": [{"Computed": "forged", "Name": "first"}],
+		"Named": {"k": {"computed": "forged", "Name": "named"}}
+	}`)
+	if os.Setenv("ENV_CONFIG_TOKEN", "forged") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	s.Checksum = "abc"
+	report, err := ProcessWithReport("env_config", []string{path}, &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Salt != "" {
+		t.Errorf("expected an empty Salt, got %s", s.Salt)
+	}
+	if s.Checksum != "abc" {
+		t.Errorf("expected %s, got %s", "abc", s.Checksum)
+	}
+	if s.Token != nil {
+		t.Errorf("expected <nil>, got %s", *s.Token)
+	}
+	if s.Inner == nil || s.Inner.Computed != "" || s.Inner.Name != "inner" {
+		t.Errorf("expected %v, got %v", internal{Name: "inner"}, s.Inner)
+	}
+	if expected := []internal{{Name: "first"}}; !reflect.DeepEqual(s.Servers, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Servers)
+	}
+	if expected := map[string]internal{"k": {Name: "named"}}; !reflect.DeepEqual(s.Named, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Named)
+	}
+	if _, ok := report["Checksum"]; ok {
+		t.Errorf("expected ignored fields to be left out of the report")
+	}
+}
+
+func TestWithDisallowUnknownFields(t *testing.T) {
+	var s struct {
+		Host     string
+		Database struct {
+			Port int
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigFile(t, dir, "common.json", `{"Host": "localhost"}`)
+	valid := writeConfigFile(t, dir, "valid.json", `{"base": "common.json", "Database": {"Port": 5432}}`)
+	if err := ProcessWithOptions(&s, WithConfigPaths(valid), WithDisallowUnknownFields()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" || s.Database.Port != 5432 {
+		t.Errorf("expected %s:%d, got %s:%d", "localhost", 5432, s.Host, s.Database.Port)
+	}
+	// the header is matched case-insensitively, like the fields
+	upper := writeConfigFile(t, dir, "upper.json", `{"Base": "common.json"}`)
+	if err := ProcessWithOptions(&s, WithConfigPaths(upper), WithDisallowUnknownFields()); err != nil {
+		t.Errorf("expected a Base header to be allowed, got %v", err)
+	}
+
+	for _, contents := range []string{`{"Hostt": "localhost"}`, `{"Database": {"Portt": 5432}}`} {
+		typo := writeConfigFile(t, dir, "typo.json", contents)
+		if err := ProcessWithOptions(&s, WithConfigPaths(typo)); err != nil {
+			t.Errorf("expected unknown keys to be ignored by default, got %s", err)
+		}
+
+		err := ProcessWithOptions(&s, WithConfigPaths(typo), WithDisallowUnknownFields())
+		v, ok := err.(*ConfigFileError)
+		if !ok {
+			t.Fatalf("expected ConfigFileError, got %v", err)
+		}
+		if v.Path != typo || !(strings.Contains(v.Error(), "Hostt") || strings.Contains(v.Error(), "Portt")) {
+			t.Errorf("expected the error to name %s and the key, got %s", typo, v)
+		}
+	}
+}
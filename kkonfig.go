@@ -5,23 +5,61 @@
 package kkonfig
 
 import (
+	"context"
 	"encoding"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"io/fs"
+	"math"
+	"net"
+	"net/url"
 	"os"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 // ErrInvalidSpecification indicates that a specification is of the wrong type.
 var ErrInvalidSpecification = errors.New("specification must be a struct pointer")
 
+// An InvalidSpecificationError occurs when a specification is not a pointer
+// to a struct. It describes what was passed instead, and matches
+// ErrInvalidSpecification with errors.Is.
+type InvalidSpecificationError struct {
+	// Kind is the kind of the specification, or of what it points to if
+	// Pointer is set.
+	Kind    reflect.Kind
+	Pointer bool
+}
+
+func (e *InvalidSpecificationError) Error() string {
+	got := e.Kind.String()
+	switch {
+	case e.Kind == reflect.Invalid:
+		got = "nil"
+	case e.Pointer:
+		got = "*" + got
+	}
+	return fmt.Sprintf("%s: got %s, want *struct", ErrInvalidSpecification, got)
+}
+
+func (e *InvalidSpecificationError) Unwrap() error {
+	return ErrInvalidSpecification
+}
+
+// ErrParse matches every *ParseError with errors.Is, whatever its cause.
+var ErrParse = errors.New("kkonfig: parse error")
+
 // A ParseError occurs when an environment variable cannot be converted to
-// the type required by a struct field during assignment.
+// the type required by a struct field during assignment. It unwraps to Err,
+// so the cause, such as a *strconv.NumError, can be reached with errors.As.
 type ParseError struct {
 	KeyName   string
 	FieldName string
@@ -46,294 +84,1679 @@ func (e *ParseError) Error() string {
 	return fmt.Sprintf("envconfig.Process: assigning %[1]s to %[2]s: converting '%[3]s' to type %[4]s. details: %[5]s", e.KeyName, e.FieldName, e.Value, e.TypeName, e.Err)
 }
 
-func processDefaultValues(spec interface{}) error {
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrParse.
+func (e *ParseError) Is(target error) bool {
+	return target == ErrParse
+}
+
+// IsRange reports whether the value was out of range for the field's type.
+func (e *ParseError) IsRange() bool {
+	return errors.Is(e.Err, strconv.ErrRange)
+}
+
+// IsSyntax reports whether the value didn't have the right syntax for the
+// field's type.
+func (e *ParseError) IsSyntax() bool {
+	return errors.Is(e.Err, strconv.ErrSyntax)
+}
+
+// newParseError describes the failure to parse value into field. For a field
+// tagged with `secret:"true"` the value is replaced with "***" and err with a
+// redactedError, since the cause may quote the value, or a part of it, in
+// ways that can't be scrubbed reliably.
+func newParseError(key, name string, field reflect.Value, tag reflect.StructTag, value string, err error) *ParseError {
+	if tag.Get("secret") == "true" {
+		err = redact(err)
+		value = "***"
+	}
+	return &ParseError{
+		KeyName:   key,
+		FieldName: name,
+		TypeName:  field.Type().String(),
+		Value:     value,
+		Err:       err,
+	}
+}
+
+// redactedError replaces the cause of a ParseError for a secret field. It only
+// keeps the strconv sentinel the cause matched, so that IsRange and IsSyntax
+// still work, and never the cause itself.
+type redactedError struct {
+	sentinel error
+}
+
+// redact returns the redactedError that stands in for err.
+func redact(err error) error {
+	for _, sentinel := range []error{strconv.ErrRange, strconv.ErrSyntax} {
+		if errors.Is(err, sentinel) {
+			return &redactedError{sentinel: sentinel}
+		}
+	}
+	return &redactedError{}
+}
+
+func (e *redactedError) Error() string {
+	if e.sentinel != nil {
+		return "invalid secret value: " + e.sentinel.Error()
+	}
+	return "invalid secret value"
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.sentinel
+}
+
+// A RequiredError occurs when no value is provided for a field tagged with
+// `required:"true"`. Desc and Example hold the field's desc and example tags,
+// which are used to tell the user how to fix it.
+type RequiredError struct {
+	KeyName   string
+	FieldName string
+	Desc      string
+	Example   string
+}
+
+func (e *RequiredError) Error() string {
+	msg := fmt.Sprintf("kkonfig: missing required %s", e.KeyName)
+	if e.Desc != "" {
+		msg += fmt.Sprintf(" (%s)", e.Desc)
+	}
+	if e.Example != "" {
+		msg += fmt.Sprintf(", e.g. %s=%s", e.KeyName, e.Example)
+	}
+	return msg
+}
+
+// An AggregateError holds every field error of a call that uses
+// WithErrorAggregation, in the order they occurred. Errors are *ParseError or
+// *RequiredError values, or *KeyCollisionError values for several collisions
+// found by WithCheckKeyCollisions.
+type AggregateError struct {
+	Errors []error
+}
+
+func (e *AggregateError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = "\t" + err.Error()
+	}
+	return fmt.Sprintf("kkonfig: %d errors:\n%s", len(e.Errors), strings.Join(msgs, "\n"))
+}
+
+func (e *AggregateError) Unwrap() []error {
+	return e.Errors
+}
+
+// A KeyCollisionError occurs when WithCheckKeyCollisions is used and several
+// fields, listed by their paths, are read from the same key. Unlike elsewhere,
+// the paths include the names of embedded structs, so that promoted fields
+// can be told apart.
+type KeyCollisionError struct {
+	Key   string
+	Paths []string
+}
+
+func (e *KeyCollisionError) Error() string {
+	return fmt.Sprintf("kkonfig: key %s is used by %s", e.Key, strings.Join(e.Paths, " and "))
+}
+
+// checkKeyCollisions makes sure that no two fields of spec are read from the
+// same key. Several collisions are returned as an *AggregateError.
+func checkKeyCollisions(o *options, spec interface{}) error {
+	var keys []string
+	paths := make(map[string][]string)
+	for _, info := range gatherInfo(o, o.prefix, spec) {
+		if _, ok := paths[info.Key]; !ok {
+			keys = append(keys, info.Key)
+		}
+		paths[info.Key] = append(paths[info.Key], info.FullPath)
+	}
+
+	var errs []error
+	for _, key := range keys {
+		if len(paths[key]) > 1 {
+			errs = append(errs, &KeyCollisionError{Key: key, Paths: paths[key]})
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &AggregateError{Errors: errs}
+}
+
+// checkUnknownEnv makes sure that every variable in the process environment
+// that starts with the prefix is read by a field of spec. It does nothing
+// without a prefix, or when the process environment isn't read. With
+// WithKeyTransformer, the prefix is the key of an empty name under it.
+func checkUnknownEnv(o *options, spec interface{}) error {
+	if o.prefix == "" || o.environ != nil || o.skipped[SourceEnv] {
+		return nil
+	}
+	prefix := joinKey(o, "", o.prefix)
+	if prefix == "" {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	for _, key := range lookupKeys(o, o.prefix, spec) {
+		known[key] = true
+	}
+	// the variable naming the environment may share the prefix, as in APP_ENV
+	if o.envConfigKey != "" {
+		known[o.envConfigKey] = true
+	}
+	var unknown []string
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if strings.HasPrefix(key, prefix) && !known[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("kkonfig: unknown environment variables: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// processDefaultValues sets fields to the value of their default tag. With
+// onlyEmpty, fields that already hold a non-zero value are left alone.
+func processDefaultValues(o *options, parent string, spec interface{}, onlyEmpty bool) error {
 	s := reflect.ValueOf(spec).Elem()
 	typeOfSpec := s.Type()
 	for i := 0; i < s.NumField(); i++ {
 		f := s.Field(i)
 		ftype := typeOfSpec.Field(i)
-		if !f.CanSet() || ftype.Tag.Get("ignored") == "true" {
+		if !f.CanSet() || isIgnored(o, ftype) || isOpaque(o, f.Type()) || isUnsupported(f.Type()) {
 			continue
 		}
 
-		for f.Kind() == reflect.Ptr {
+		for f.Kind() == reflect.Ptr && !hasCustomParser(o, f) {
+			if f.Type().Elem().Kind() != reflect.Struct {
+				// pointer to a non-struct: leave it to processField
+				break
+			}
 			if f.IsNil() {
-				if f.Type().Elem().Kind() != reflect.Struct {
-					// nil pointer to a non-struct: leave it alone
-					break
-				}
 				// nil pointer to struct: create a zero instance
 				f.Set(reflect.New(f.Type().Elem()))
 			}
 			f = f.Elem()
 		}
 
-		if f.Kind() == reflect.Struct {
+		path := ftype.Name
+		if parent != "" {
+			path = parent + "." + path
+		}
+
+		if f.Kind() == reflect.Struct && !hasCustomParser(o, f) {
+			innerPath := path
+			if ftype.Anonymous {
+				innerPath = parent
+			}
+
 			embeddedPtr := f.Addr().Interface()
-			if err := processDefaultValues(embeddedPtr); err != nil {
+			if err := processDefaultValues(o, innerPath, embeddedPtr, onlyEmpty); err != nil {
 				return err
 			}
 			f.Set(reflect.ValueOf(embeddedPtr).Elem())
 			continue
 		}
 
+		if onlyEmpty {
+			// skip fields with a value, and those whose default already failed
+			if _, ok := o.origins[path]; !ok || !f.IsZero() {
+				continue
+			}
+		}
+
 		if value, ok := ftype.Tag.Lookup("default"); ok {
-			if err := processField(value, f); err != nil {
-				return &ParseError{
-					FieldName: ftype.Name,
-					TypeName:  f.Type().String(),
-					Value:     value,
-					Err:       err,
+			var err error
+			if strings.HasPrefix(value, "@") {
+				var generated string
+				if generated, err = generateDefault(value); err == nil {
+					value = generated
+				}
+			} else {
+				value, err = expandDefault(o, value)
+			}
+			if empty, ok := emptyContainer(value, f.Type()); ok && err == nil && !hasCustomParser(o, f) {
+				f.Set(empty)
+			} else if err == nil {
+				err = processField(o, value, f, ftype.Tag)
+			}
+			if err != nil {
+				err = o.fail(newParseError("", ftype.Name, f, ftype.Tag, value, err))
+				if err != nil {
+					return err
 				}
+				continue
 			}
+			o.setOrigin(path, Origin{Source: SourceDefault})
 		}
 
 	}
 	return nil
 }
 
-func processJson(configPaths []string, spec interface{}) error {
-	// Parse potential json files into the specification
-	if configPaths != nil {
-		for _, path := range configPaths {
-			if jsonBytes, err := ioutil.ReadFile(path); err == nil {
-				if json.Unmarshal(jsonBytes, spec) != nil {
-					continue
-				}
-			}
+// emptyContainer returns an empty, non-nil value of type t for a default of []
+// for slices or {} for maps, including through pointers to them.
+func emptyContainer(value string, t reflect.Type) (reflect.Value, bool) {
+	switch {
+	case t.Kind() == reflect.Ptr:
+		elem, ok := emptyContainer(value, t.Elem())
+		if !ok {
+			return reflect.Value{}, false
 		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(elem)
+		return p, true
+	case value == "[]" && t.Kind() == reflect.Slice:
+		return reflect.MakeSlice(t, 0, 0), true
+	case value == "{}" && t.Kind() == reflect.Map:
+		return reflect.MakeMap(t), true
 	}
-	return nil
+	return reflect.Value{}, false
+}
+
+// expandDefault expands references to environment variables in a default
+// value, written as ${VAR} or $VAR, with $$ for a literal dollar. Undefined
+// variables expand to an empty string, or are an error with
+// WithStrictDefaults.
+func expandDefault(o *options, value string) (string, error) {
+	var err error
+	expanded := os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		v, ok := o.env(nil).Lookup(name)
+		if !ok && o.strictDefaults && err == nil {
+			err = fmt.Errorf("default references undefined variable %s", name)
+		}
+		return v
+	})
+	return expanded, err
+}
+
+// varInfo describes a field of a specification that is read from a single
+// environment variable.
+type varInfo struct {
+	Name string
+	Path string
+	// FullPath is Path including the names of embedded structs
+	FullPath string
+	Key      string
+	Field    reflect.Value
+	Tags     reflect.StructTag
+}
+
+// gatherInfo walks spec and returns the fields that are read from the
+// environment, descending into nested structs that don't parse themselves.
+func gatherInfo(o *options, prefix string, spec interface{}) []varInfo {
+	return gatherFieldInfo(o, prefix, "", "", spec, nil)
+}
+
+// gatherStructSlices walks spec like gatherInfo, but returns the slices of
+// structs it contains, keyed by the key that holds their length.
+func gatherStructSlices(o *options, prefix string, spec interface{}) []varInfo {
+	var slices []varInfo
+	gatherFieldInfo(o, prefix, "", "", spec, &slices)
+	return slices
 }
 
-func processEnvironmentValues(prefix string, spec interface{}) error {
+// gatherFieldInfo is gatherInfo for a struct found at the given field path,
+// which is fullParent when the names of embedded structs are included. Like
+// Go selectors, paths omit the names of embedded structs. The slices of
+// structs that are walked are added to slices unless it is nil.
+func gatherFieldInfo(o *options, prefix, parent, fullParent string, spec interface{}, slices *[]varInfo) []varInfo {
 	s := reflect.ValueOf(spec).Elem()
 	typeOfSpec := s.Type()
+	infos := make([]varInfo, 0, s.NumField())
 	for i := 0; i < s.NumField(); i++ {
 		f := s.Field(i)
 		ftype := typeOfSpec.Field(i)
-		if !f.CanSet() || ftype.Tag.Get("ignored") == "true" {
+		if !f.CanSet() || isIgnored(o, ftype) || isOpaque(o, f.Type()) || isUnsupported(f.Type()) {
 			continue
 		}
 
-		for f.Kind() == reflect.Ptr {
+		ok := true
+		for f.Kind() == reflect.Ptr && !hasCustomParser(o, f) {
+			if f.Type().Elem().Kind() != reflect.Struct {
+				// pointer to a non-struct: leave it to processField
+				break
+			}
 			if f.IsNil() {
-				if f.Type().Elem().Kind() != reflect.Struct {
-					// nil pointer to a non-struct: leave it alone
+				// nil pointer to struct: create a zero instance
+				if f, ok = newStruct(o, f); !ok {
 					break
 				}
-				// nil pointer to struct: create a zero instance
-				f.Set(reflect.New(f.Type().Elem()))
 			}
 			f = f.Elem()
 		}
+		if !ok {
+			continue
+		}
 
 		fieldName := ftype.Name
-		if alt := ftype.Tag.Get("envconfig"); alt != "" {
+		key := fieldName
+		if alt := ftype.Tag.Get(o.tagName); alt != "" {
 			fieldName = alt
+			key = alt
+		} else if name := jsonTagName(ftype); o.jsonTagNames && name != "" {
+			key = name
+		} else if o.splitWords || ftype.Tag.Get("split_words") == "true" {
+			key = splitWords(key)
 		}
 
-		key := fieldName
-		// If a prefix has been specified, modify the key from "key" to "prefix_key"
-		if prefix != "" {
-			key = fmt.Sprintf("%s_%s", prefix, key)
+		path, fullPath := ftype.Name, ftype.Name
+		if parent != "" {
+			path = parent + "." + path
+		}
+		if fullParent != "" {
+			fullPath = fullParent + "." + fullPath
 		}
 
-		// Environment variables should be uppercase, modify from "prefix_key" to "PREFIX_KEY"
-		key = strings.ToUpper(key)
+		key = joinKey(o, key, prefix)
 
 		// The current field is a struct, continue going through that struct but with a new prefix
 		if f.Kind() == reflect.Struct {
 			// honor Decode if present
-			if decoderFrom(f) == nil && setterFrom(f) == nil && textUnmarshaler(f) == nil {
-				innerPrefix := prefix
+			if !hasCustomParser(o, f) {
+				innerPrefix, innerPath := prefix, parent
 				if !ftype.Anonymous {
-					innerPrefix = key
+					innerPrefix, innerPath = key, path
 				}
-
-				embeddedPtr := f.Addr().Interface()
-				if err := processEnvironmentValues(innerPrefix, embeddedPtr); err != nil {
-					return err
+				// the prefix tag replaces the whole prefix of the subtree
+				if p, ok := ftype.Tag.Lookup("prefix"); ok {
+					innerPrefix = p
 				}
-				f.Set(reflect.ValueOf(embeddedPtr).Elem())
 
+				infos = append(infos, gatherFieldInfo(o, innerPrefix, innerPath, fullPath, f.Addr().Interface(), slices)...)
 				continue
 			}
 		}
 
-		// `os.Getenv` cannot differentiate between an explicitly set empty value
-		// and an unset value. `os.LookupEnv` is preferred to `syscall.Getenv`,
-		// but it is only available in go1.5 or newer. We're using Go build tags
-		// here to use os.LookupEnv for >=go1.5
-		if value, ok := os.LookupEnv(key); ok {
-			if err := processField(value, f); err != nil {
-				return &ParseError{
-					KeyName:   key,
-					FieldName: fieldName,
-					TypeName:  f.Type().String(),
-					Value:     value,
-					Err:       err,
-				}
+		// the elements of a slice of structs are walked with their index as
+		// a key segment, e.g. SERVERS_0_PORT
+		if isStructSlice(o, f) {
+			if slices != nil {
+				*slices = append(*slices, varInfo{
+					Name:     fieldName,
+					Path:     path,
+					FullPath: fullPath,
+					Key:      joinKey(o, "COUNT", key),
+					Field:    f,
+					Tags:     ftype.Tag,
+				})
 			}
-		}
-
-		// fmt.Printf("Env value: %s: %#v\n", fieldName, value)
-
-		/*
-			req := ftype.Tag.Get("required")
-			if !ok && def == "" && !set {
-				if req == "true" {
-					return fmt.Errorf("required key %s missing value", key)
+			for j := 0; j < f.Len(); j++ {
+				elem, ok := structElem(o, f.Index(j))
+				if !ok {
+					continue
 				}
-				continue
+				elemPrefix, elemPath := joinKey(o, strconv.Itoa(j), key), fmt.Sprintf("%s[%d]", path, j)
+				elemFullPath := fmt.Sprintf("%s[%d]", fullPath, j)
+				infos = append(infos, gatherFieldInfo(o, elemPrefix, elemPath, elemFullPath, elem.Addr().Interface(), slices)...)
 			}
-		*/
+			continue
+		}
 
+		infos = append(infos, varInfo{
+			Name:     fieldName,
+			Path:     path,
+			FullPath: fullPath,
+			Key:      key,
+			Field:    f,
+			Tags:     ftype.Tag,
+		})
 	}
-	return nil
+	return infos
 }
 
-// Process populates the specified struct in the following steps:
-// 1. Fill in with default values
-// 2. Read from given config files
-// 3. Read from environment variables
-// TODO: Parse values in three steps instead of just 1. Less performant but more unsure
-func Process(prefix string, configPaths []string, spec interface{}) error {
-	// Sanity check on struct to make sure it's a pointer to a struct
-	s := reflect.ValueOf(spec)
-
-	if s.Kind() != reflect.Ptr {
-		return ErrInvalidSpecification
+// joinKey returns the key of name, the name of a field or a key segment such as
+// the index of an element, under prefix.
+func joinKey(o *options, name, prefix string) string {
+	if o.keyTransformer != nil {
+		// the transformer has the final say over the key
+		return o.keyTransformer(name, prefix)
 	}
-	s = s.Elem()
-	if s.Kind() != reflect.Struct {
-		return ErrInvalidSpecification
+
+	key := name
+	// If a prefix has been specified, modify the key from "key" to "prefix_key"
+	if prefix != "" {
+		key = prefix + o.keySeparator + key
 	}
 
-	err := processDefaultValues(spec)
-	if err != nil {
-		return err
+	// Environment variables should be uppercase, modify from "prefix_key" to "PREFIX_KEY"
+	if !o.caseSensitiveKeys {
+		key = strings.ToUpper(key)
 	}
-	err = processJson(configPaths, spec)
-	if err != nil {
-		return err
+	return key
+}
+
+// isStructSlice reports whether field is a slice of structs, or of pointers to
+// structs, whose elements are walked like nested structs.
+func isStructSlice(o *options, field reflect.Value) bool {
+	if field.Kind() != reflect.Slice || hasCustomParser(o, field) {
+		return false
 	}
-	err = processEnvironmentValues(prefix, spec)
-	if err != nil {
-		return err
+	elem := field.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
 	}
-
-	return nil
+	return elem.Kind() == reflect.Struct && !hasCustomParser(o, reflect.New(elem).Elem())
 }
 
-// MustProcess is the same as Process but panics if an error occurs
-func MustProcess(prefix string, configPaths []string, spec interface{}) {
-	if err := Process(prefix, configPaths, spec); err != nil {
-		panic(err)
+// structElem returns the struct an element of a slice of structs holds,
+// allocating nil pointers on the way. It reports false if o.nilStructs skips
+// a nil pointer.
+func structElem(o *options, v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			var ok bool
+			if v, ok = newStruct(o, v); !ok {
+				return v, false
+			}
+		}
+		v = v.Elem()
 	}
+	return v, true
 }
 
-func processField(value string, field reflect.Value) error {
-	typ := field.Type()
+// nilStructMode is how walking a spec treats nil pointers to structs.
+type nilStructMode int
 
-	decoder := decoderFrom(field)
-	if decoder != nil {
-		return decoder.Decode(value)
-	}
-	// look for Set method if Decode not defined
-	setter := setterFrom(field)
-	if setter != nil {
-		return setter.Set(value)
-	}
+const (
+	// allocateNilStructs sets them to a zero instance, which processing
+	// then fills in.
+	allocateNilStructs nilStructMode = iota
+	// zeroNilStructs walks a zero instance without storing it, leaving the
+	// spec as is.
+	zeroNilStructs
+	// skipNilStructs leaves them out.
+	skipNilStructs
+)
 
-	if t := textUnmarshaler(field); t != nil {
-		return t.UnmarshalText([]byte(value))
+// newStruct returns a pointer to a zero instance of the struct the nil pointer
+// v points to, storing it in v unless o.nilStructs says otherwise. It reports
+// false if v is to be skipped instead.
+func newStruct(o *options, v reflect.Value) (reflect.Value, bool) {
+	switch o.nilStructs {
+	case zeroNilStructs:
+		return reflect.New(v.Type().Elem()), true
+	case skipNilStructs:
+		return v, false
 	}
+	v.Set(reflect.New(v.Type().Elem()))
+	return v, true
+}
 
-	if typ.Kind() == reflect.Ptr {
-		typ = typ.Elem()
-		if field.IsNil() {
-			field.Set(reflect.New(typ))
-		}
-		field = field.Elem()
-	}
+// resizeStructSlices sets the length of the slices of structs whose COUNT key,
+// such as SERVERS_COUNT, src holds a value for. Elements that are added get
+// their default values, and their own slices are resized in turn.
+func resizeStructSlices(o *options, prefix string, spec interface{}, src ConfigSource, source Source) error {
+	done := make(map[string]bool)
+	for {
+		resized := false
+		for _, info := range gatherStructSlices(o, prefix, spec) {
+			if done[info.Key] {
+				continue
+			}
+			value, ok := src.Lookup(info.Key)
+			if !ok {
+				continue
+			}
+			done[info.Key] = true
+			resized = true
 
-	switch typ.Kind() {
-	case reflect.String:
-		field.SetString(value)
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		var (
-			val int64
-			err error
-		)
-		if field.Kind() == reflect.Int64 && typ.PkgPath() == "time" && typ.Name() == "Duration" {
-			var d time.Duration
-			d, err = time.ParseDuration(value)
-			val = int64(d)
-		} else {
-			val, err = strconv.ParseInt(value, 0, typ.Bits())
+			n, err := strconv.Atoi(value)
+			if err == nil && n < 0 {
+				err = fmt.Errorf("count must not be negative")
+			}
+			if err != nil {
+				err = o.fail(newParseError(info.Key, info.Name, info.Field, info.Tags, value, err))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			o.setOrigin(info.Path, Origin{Source: source, Location: info.Key})
+			f := info.Field
+			if n <= f.Len() {
+				f.Set(f.Slice(0, n))
+				continue
+			}
+			grown := reflect.MakeSlice(f.Type(), n, n)
+			reflect.Copy(grown, f)
+			old := f.Len()
+			f.Set(grown)
+			for i := old; i < n; i++ {
+				elem, _ := structElem(o, f.Index(i))
+				path := fmt.Sprintf("%s[%d]", info.Path, i)
+				if err := processDefaultValues(o, path, elem.Addr().Interface(), false); err != nil {
+					return err
+				}
+			}
 		}
-		if err != nil {
-			return err
+		if !resized {
+			return nil
 		}
+	}
+}
 
-		field.SetInt(val)
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		val, err := strconv.ParseUint(value, 0, typ.Bits())
-		if err != nil {
-			return err
+// splitWords separates the words of a CamelCase field name with underscores,
+// e.g. MultiWordVar becomes Multi_Word_Var. A run of capitals is kept together
+// as an acronym, so APIKey becomes API_Key, and numbers are words of their
+// own, so Retry2Delay becomes Retry_2_Delay. Mixed-case initialisms such as
+// MySQL stay whole, so MySQLHost becomes MySQL_Host.
+func splitWords(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i := 0; i < len(runes); {
+		split := i > 0 && splitsWord(runes[i-1], runes[i], runes[i+1:])
+		if split {
+			b.WriteRune('_')
 		}
-		field.SetUint(val)
-	case reflect.Bool:
-		val, err := strconv.ParseBool(value)
-		if err != nil {
-			return err
+		if n := initialismAt(runes[i:]); n > 0 && (i == 0 || split) {
+			b.WriteString(string(runes[i : i+n]))
+			i += n
+			continue
 		}
-		field.SetBool(val)
-	case reflect.Float32, reflect.Float64:
-		val, err := strconv.ParseFloat(value, typ.Bits())
-		if err != nil {
-			return err
+		b.WriteRune(runes[i])
+		i++
+	}
+	return b.String()
+}
+
+// initialisms are the mixed-case words that splitWords keeps together, which
+// would otherwise be split at their inner capitals or numbers.
+var initialisms = []string{"GraphQL", "IPv4", "IPv6", "MySQL", "NoSQL", "OAuth", "PostgreSQL"}
+
+// initialismAt returns the length of the initialism that runes start with, or
+// 0 if there is none. An initialism followed by a lowercase letter is part of
+// a longer word and doesn't count.
+func initialismAt(runes []rune) int {
+	for _, word := range initialisms {
+		w := []rune(word)
+		if len(runes) < len(w) || string(runes[:len(w)]) != word {
+			continue
 		}
-		field.SetFloat(val)
-	case reflect.Slice:
-		vals := strings.Split(value, ",")
-		sl := reflect.MakeSlice(typ, len(vals), len(vals))
-		for i, val := range vals {
-			err := processField(val, sl.Index(i))
-			if err != nil {
-				return err
-			}
+		if len(runes) > len(w) && unicode.IsLower(runes[len(w)]) {
+			continue
 		}
-		field.Set(sl)
+		return len(w)
 	}
+	return 0
+}
 
-	return nil
+// splitsWord reports whether a new word starts at r, given the rune before it
+// and the runes after it.
+func splitsWord(prev, r rune, next []rune) bool {
+	switch {
+	case unicode.IsDigit(r):
+		return unicode.IsLetter(prev)
+	case unicode.IsUpper(r):
+		acronymEnd := unicode.IsUpper(prev) && len(next) > 0 && unicode.IsLower(next[0])
+		return unicode.IsLower(prev) || unicode.IsDigit(prev) || acronymEnd
+	}
+	return false
 }
 
-func interfaceFrom(field reflect.Value, fn func(interface{}, *bool)) {
-	// it may be impossible for a struct field to fail this check
-	if !field.CanInterface() {
-		return
+func processEnvironmentValues(o *options, prefix string, spec interface{}) error {
+	dotenv, err := loadDotEnv(o)
+	if err != nil {
+		return err
 	}
-	var ok bool
-	fn(field.Interface(), &ok)
-	if !ok && field.CanAddr() {
-		fn(field.Addr().Interface(), &ok)
+	env := o.env(dotenv)
+	if err := processSource(o, prefix, spec, env, SourceEnv); err != nil {
+		return err
 	}
+	if err := processAlternateValues(o, prefix, spec, env); err != nil {
+		return err
+	}
+	return processFileValues(o, prefix, spec, env)
 }
 
-func decoderFrom(field reflect.Value) (d Decoder) {
-	interfaceFrom(field, func(v interface{}, ok *bool) { d, *ok = v.(Decoder) })
-	return d
+// alternateKeys returns the keys listed in the `aliases` and `deprecated` tags,
+// in that order, along with how many of them are aliases.
+func alternateKeys(tag reflect.StructTag) ([]string, int) {
+	keys := splitKeys(tag.Get("aliases"))
+	return append(keys, splitKeys(tag.Get("deprecated"))...), len(keys)
 }
 
-func setterFrom(field reflect.Value) (s Setter) {
-	interfaceFrom(field, func(v interface{}, ok *bool) { s, *ok = v.(Setter) })
-	return s
+// splitKeys splits a comma separated list of keys
+func splitKeys(list string) []string {
+	if list == "" {
+		return nil
+	}
+	keys := strings.Split(list, ",")
+	for i, key := range keys {
+		keys[i] = strings.TrimSpace(key)
+	}
+	return keys
 }
 
-func textUnmarshaler(field reflect.Value) (t encoding.TextUnmarshaler) {
-	interfaceFrom(field, func(v interface{}, ok *bool) { t, *ok = v.(encoding.TextUnmarshaler) })
+// processAlternateValues populates fields tagged with `aliases:"KEY1,KEY2"` or
+// `deprecated:"OLD_KEY"` from the first of the comma separated keys that is
+// set, as long as the field's own key isn't. Aliases are tried before
+// deprecated keys, each from left to right, and each deprecated key that was
+// used is reported to the WithOnDeprecated callback.
+func processAlternateValues(o *options, prefix string, spec interface{}, env Lookuper) error {
+	for _, info := range gatherInfo(o, prefix, spec) {
+		keys, aliases := alternateKeys(info.Tags)
+		if len(keys) == 0 {
+			continue
+		}
+		if _, ok := env.Lookup(info.Key); ok {
+			continue
+		}
+		for i, old := range keys {
+			value, ok := env.Lookup(old)
+			if !ok {
+				continue
+			}
+			if i >= aliases && o.onDeprecated != nil {
+				o.onDeprecated(old, info.Key)
+			}
+			resolved, err := resolveIndirect(o, value, env)
+			if err == nil {
+				// a value that was resolved is reported as such
+				value = resolved
+				err = processField(o, value, info.Field, info.Tags)
+			}
+			if err != nil {
+				err = o.fail(newParseError(old, info.Name, info.Field, info.Tags, value, err))
+				if err != nil {
+					return err
+				}
+				break
+			}
+			o.setOrigin(info.Path, Origin{Source: SourceEnv, Location: old})
+			break
+		}
+	}
+	return nil
+}
+
+// processFileValues populates fields tagged with `file:"NAME"` from the file
+// at the path held by the environment variable NAME, following the _FILE
+// convention for mounted secrets. A file value takes precedence over the
+// field's own environment variable, and a single trailing newline is trimmed.
+func processFileValues(o *options, prefix string, spec interface{}, env ConfigSource) error {
+	for _, info := range gatherInfo(o, prefix, spec) {
+		name := info.Tags.Get("file")
+		if name == "" {
+			continue
+		}
+		path, ok := env.Lookup(name)
+		if !ok || path == "" {
+			continue
+		}
+
+		value, err := readValueFile(o, path)
+		if err != nil {
+			return &ConfigFileError{Path: path, Err: err}
+		}
+
+		if err := processField(o, value, info.Field, info.Tags); err != nil {
+			err = o.fail(newParseError(name, info.Name, info.Field, info.Tags, value, err))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		o.setOrigin(info.Path, Origin{Source: SourceFile, Location: path})
+	}
+	return nil
+}
+
+// processSource populates spec with the values src holds for the environment
+// variable names of its fields.
+func processSource(o *options, prefix string, spec interface{}, src ConfigSource, source Source) error {
+	if err := resizeStructSlices(o, prefix, spec, src, source); err != nil {
+		return err
+	}
+	infos := gatherInfo(o, prefix, spec)
+	templates := make(map[string]templateValue)
+	for _, info := range infos {
+		if value, ok := src.Lookup(info.Key); ok {
+			origin := Origin{Source: source, Location: info.Key}
+			if source == SourceEnv {
+				resolved, err := resolveIndirect(o, value, src)
+				if err != nil {
+					err = o.fail(newParseError(info.Key, info.Name, info.Field, info.Tags, value, err))
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				value = resolved
+			}
+			// templated values are resolved once every other field is set
+			if info.Tags.Get("template") == "true" {
+				templates[info.Path] = templateValue{value: value, origin: origin}
+				continue
+			}
+			if err := processField(o, value, info.Field, info.Tags); err != nil {
+				err = o.fail(newParseError(info.Key, info.Name, info.Field, info.Tags, value, err))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			o.setOrigin(info.Path, origin)
+		}
+	}
+	return resolveTemplates(o, infos, templates)
+}
+
+// checkRequired makes sure that every field tagged with `required:"true"`
+// was given a value by at least one of the layers.
+func checkRequired(o *options, prefix string, spec interface{}) error {
+	// a value that failed to parse was provided, and has its own error
+	failed := make(map[string]bool)
+	for _, err := range o.errs {
+		if v, ok := err.(*ParseError); ok {
+			failed[v.KeyName] = true
+		}
+	}
+	for _, info := range gatherInfo(o, prefix, spec) {
+		if _, ok := o.origins[info.Path]; ok || info.Tags.Get("required") != "true" {
+			continue
+		}
+		keys, _ := alternateKeys(info.Tags)
+		if name := info.Tags.Get("file"); name != "" {
+			keys = append(keys, name)
+		}
+		provided := failed[info.Key]
+		for _, key := range keys {
+			provided = provided || failed[key]
+		}
+		if provided {
+			continue
+		}
+		err := o.fail(&RequiredError{
+			KeyName:   info.Key,
+			FieldName: info.Name,
+			Desc:      info.Tags.Get("desc"),
+			Example:   info.Tags.Get("example"),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Process populates the specified struct in the following steps:
+// 1. Fill in with default values
+// 2. Read from given config files
+// 3. Read from environment variables
+// Process keeps no state between calls, so separate specs can be processed
+// concurrently. A single spec must not be processed or read concurrently.
+// TODO: Parse values in three steps instead of just 1. Less performant but more unsure
+func Process(prefix string, configPaths []string, spec interface{}) error {
+	return ProcessContext(context.Background(), prefix, configPaths, spec)
+}
+
+// ProcessContext is the same as Process, but stops with ctx.Err() once ctx is
+// done, including while config is being fetched over the network.
+func ProcessContext(ctx context.Context, prefix string, configPaths []string, spec interface{}) error {
+	return ProcessWithOptions(spec, WithContext(ctx), WithPrefix(prefix), WithConfigPaths(configPaths...))
+}
+
+// ProcessFS is the same as Process, but reads config files from fsys, such as
+// an embed.FS or an fstest.MapFS, instead of the OS filesystem. configPaths
+// are slash-separated paths relative to the root of fsys.
+func ProcessFS(fsys fs.FS, prefix string, configPaths []string, spec interface{}) error {
+	return ProcessWithOptions(spec, WithFS(fsys), WithPrefix(prefix), WithConfigPaths(configPaths...))
+}
+
+// ProcessMap is the same as Process without config files, but looks up values
+// in values instead of the environment, using the same keys. This makes it
+// easy to test config parsing without setting environment variables, or to
+// populate a spec from a flattened key-value store.
+func ProcessMap(prefix string, values map[string]string, spec interface{}) error {
+	o := newOptions([]Option{WithPrefix(prefix)})
+	o.environ = MapLookuper(values)
+	return process(o, spec)
+}
+
+// ProcessStrict is the same as Process, but it is an error for a variable in
+// the environment that starts with the prefix not to be read by any field, so
+// that stale or mistyped variables don't go unnoticed.
+func ProcessStrict(prefix string, configPaths []string, spec interface{}) error {
+	return ProcessWithOptions(spec, WithPrefix(prefix), WithConfigPaths(configPaths...), WithDisallowUnknownEnv())
+}
+
+// ProcessReaders is the same as Process, but reads json documents from
+// readers instead of from config files.
+func ProcessReaders(prefix string, readers []io.Reader, spec interface{}) error {
+	return ProcessWithOptions(spec, WithPrefix(prefix), WithConfigReaders(readers...))
+}
+
+// ProcessMany runs Process for each of specs in turn, against the same config
+// files and environment. This lets separate modules own their config structs.
+// The returned error identifies the spec that failed.
+func ProcessMany(prefix string, configPaths []string, specs ...interface{}) error {
+	for i, spec := range specs {
+		if err := Process(prefix, configPaths, spec); err != nil {
+			return fmt.Errorf("kkonfig: processing spec %d (%T): %w", i, spec, err)
+		}
+	}
+	return nil
+}
+
+// ProcessWithOptions populates the specified struct in the same steps as
+// Process, configured by the given options.
+func ProcessWithOptions(spec interface{}, opts ...Option) error {
+	return process(newOptions(opts), spec)
+}
+
+// pipelineSteps holds the step of the pipeline that applies each layer. The
+// steps run in the order given by WithSourceOrder.
+var pipelineSteps = map[Source]func(o *options, spec interface{}) error{
+	SourceDefault: defaultsStep,
+	SourceFile:    fileStep,
+	SourceEnv:     envStep,
+}
+
+// defaultsStep applies the default values
+func defaultsStep(o *options, spec interface{}) error {
+	return processDefaultValues(o, "", spec, false)
+}
+
+// fileStep applies the config files, preceded by the sources consulted before
+// them
+func fileStep(o *options, spec interface{}) error {
+	err := processSources(o, SourceBeforeJSON, spec)
+	if err != nil {
+		return err
+	}
+	err = processJson(o, spec)
+	if err != nil {
+		return err
+	}
+	if o.defaultsForEmpty {
+		return processDefaultValues(o, "", spec, true)
+	}
+	return nil
+}
+
+// envStep applies the environment, surrounded by the sources consulted before
+// and after it
+func envStep(o *options, spec interface{}) error {
+	err := processSources(o, SourceBeforeEnv, spec)
+	if err != nil {
+		return err
+	}
+	err = processEnvironmentValues(o, o.prefix, spec)
+	if err != nil {
+		return err
+	}
+	return processSources(o, SourceAfterEnv, spec)
+}
+
+// checkSourceOrder makes sure that order contains every step of the pipeline
+// exactly once
+func checkSourceOrder(order []Source) error {
+	seen := make(map[Source]bool)
+	for _, source := range order {
+		if _, ok := pipelineSteps[source]; !ok || seen[source] {
+			return fmt.Errorf("kkonfig: invalid source order %v", order)
+		}
+		seen[source] = true
+	}
+	if len(seen) != len(pipelineSteps) {
+		return fmt.Errorf("kkonfig: invalid source order %v", order)
+	}
+	return nil
+}
+
+// process runs every step of the pipeline over spec
+func process(o *options, spec interface{}) error {
+	if err := checkSpec(spec); err != nil {
+		return err
+	}
+	if err := checkSourceOrder(o.sourceOrder); err != nil {
+		return err
+	}
+	if o.checkKeyCollisions {
+		if err := checkKeyCollisions(o, spec); err != nil {
+			return err
+		}
+	}
+	for _, source := range o.sourceOrder {
+		if err := o.ctx.Err(); err != nil {
+			return err
+		}
+		if o.skipped[source] {
+			continue
+		}
+		if err := pipelineSteps[source](o, spec); err != nil {
+			return err
+		}
+	}
+	if o.flagSet != nil {
+		if err := processFlags(o, spec); err != nil {
+			return err
+		}
+	}
+	// the keys of slices of structs are only known once the layers have
+	// sized them
+	if o.disallowUnknownEnv {
+		if err := checkUnknownEnv(o, spec); err != nil {
+			return err
+		}
+	}
+	// a required field may be provided by a layer that was skipped
+	if len(o.skipped) == 0 {
+		if err := checkRequired(o, o.prefix, spec); err != nil {
+			return err
+		}
+	}
+
+	if len(o.errs) > 0 {
+		return &AggregateError{Errors: o.errs}
+	}
+	if err := validate(o, "", reflect.ValueOf(spec)); err != nil {
+		return err
+	}
+	if o.report != nil {
+		*o.report = newReport(o, spec)
+	}
+	return nil
+}
+
+// MustProcess is the same as Process but panics if an error occurs
+func MustProcess(prefix string, configPaths []string, spec interface{}) {
+	MustProcessWithOptions(spec, WithPrefix(prefix), WithConfigPaths(configPaths...))
+}
+
+// MustProcessWithOptions is the same as ProcessWithOptions but panics if an
+// error occurs. The panic value is an error that wraps it and names the type
+// of spec and the prefix, so that it is clear which call failed.
+func MustProcessWithOptions(spec interface{}, opts ...Option) {
+	o := newOptions(opts)
+	if err := process(o, spec); err != nil {
+		prefix := o.prefix
+		if !o.caseSensitiveKeys {
+			prefix = strings.ToUpper(prefix)
+		}
+		panic(fmt.Errorf("kkonfig: failed to process %T (prefix %s): %w", spec, prefix, err))
+	}
+}
+
+// ProcessOrUsage is the same as Process, but instead of returning an error it
+// writes the error followed by the Usage table to out. It returns whether
+// processing succeeded, so that command line tools can exit cleanly.
+func ProcessOrUsage(prefix string, configPaths []string, spec interface{}, out io.Writer) bool {
+	err := Process(prefix, configPaths, spec)
+	if err == nil {
+		return true
+	}
+
+	fmt.Fprintf(out, "%s\n\n", err)
+	Usage(prefix, spec, out)
+	return false
+}
+
+// checkSpec makes sure that spec is a pointer to a struct
+func checkSpec(spec interface{}) error {
+	s := reflect.ValueOf(spec)
+
+	if s.Kind() != reflect.Ptr {
+		return &InvalidSpecificationError{Kind: s.Kind()}
+	}
+	s = s.Elem()
+	if s.Kind() != reflect.Struct {
+		return &InvalidSpecificationError{Kind: s.Kind(), Pointer: true}
+	}
+	return nil
+}
+
+func processField(o *options, value string, field reflect.Value, tag reflect.StructTag) error {
+	typ := field.Type()
+
+	if o.trimSpace {
+		value = strings.TrimSpace(value)
+	}
+	if tag.Get("nullable") == "true" && value == o.nullSentinel {
+		field.Set(reflect.Zero(typ))
+		return nil
+	}
+	if tag.Get("oneof") != "" {
+		elem := typ
+		for elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		// the elements of slices and maps are checked one by one
+		switch elem.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+		default:
+			var err error
+			if value, err = matchOneOf(value, tag); err != nil {
+				return err
+			}
+		}
+	}
+
+	if fn, ok := o.decoders[typ]; ok {
+		return decodeWith(fn, value, field)
+	}
+
+	// allocate nil pointers first so that custom parsers with pointer
+	// receivers are never called on a nil value
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+		if field.IsNil() {
+			field.Set(reflect.New(typ))
+		}
+		field = field.Elem()
+
+		if fn, ok := o.decoders[typ]; ok {
+			return decodeWith(fn, value, field)
+		}
+	}
+
+	decoder := decoderFrom(field)
+	if decoder != nil {
+		return decoder.Decode(value)
+	}
+	// look for Set method if Decode not defined
+	setter := setterFrom(field)
+	if setter != nil {
+		return setter.Set(value)
+	}
+
+	// nullable types like sql.NullInt64 hold the parsed value and are
+	// marked valid, so that a value given as empty is told apart from none
+	if isNullable(typ) {
+		if err := processField(o, value, field.Field(0), tag); err != nil {
+			return err
+		}
+		field.Field(1).SetBool(true)
+		return nil
+	}
+
+	if ok, err := parseStandardType(value, field, tag); ok {
+		return err
+	}
+
+	if t := textUnmarshaler(field); t != nil {
+		return t.UnmarshalText([]byte(value))
+	}
+
+	if b := binaryUnmarshaler(field); b != nil {
+		data, err := decodeBytes(value, tag)
+		if err != nil {
+			return err
+		}
+		return b.UnmarshalBinary(data)
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var (
+			val int64
+			err error
+		)
+		// typ is the type of the value being parsed, so this also covers
+		// durations in pointers, slices and maps
+		if typ == durationType {
+			var d time.Duration
+			d, err = time.ParseDuration(value)
+			val = int64(d)
+		} else if tag.Get("format") == "bytesize" {
+			var size uint64
+			if size, err = parseByteSize(value); err == nil {
+				if size > math.MaxInt64 || field.OverflowInt(int64(size)) {
+					return fmt.Errorf("byte size %q overflows %s: %w", value, typ, strconv.ErrRange)
+				}
+				val = int64(size)
+			}
+		} else {
+			var base int
+			if base, err = baseFrom(tag); err == nil {
+				val, err = strconv.ParseInt(value, base, typ.Bits())
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(val)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tag.Get("format") == "bytesize" {
+			size, err := parseByteSize(value)
+			if err != nil {
+				return err
+			}
+			if field.OverflowUint(size) {
+				return fmt.Errorf("byte size %q overflows %s: %w", value, typ, strconv.ErrRange)
+			}
+			field.SetUint(size)
+			break
+		}
+		base, err := baseFrom(tag)
+		if err != nil {
+			return err
+		}
+		val, err := strconv.ParseUint(value, base, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(val)
+	case reflect.Bool:
+		val, err := parseBool(o, value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(val)
+	case reflect.Float32, reflect.Float64:
+		if sep := tag.Get("decimal"); sep != "" {
+			value = strings.Replace(value, sep, ".", -1)
+		}
+		val, err := strconv.ParseFloat(value, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(val)
+	case reflect.Complex64, reflect.Complex128:
+		val, err := strconv.ParseComplex(value, typ.Bits())
+		if err != nil {
+			return err
+		}
+		field.SetComplex(val)
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			b, err := decodeBytes(value, tag)
+			if err != nil {
+				return err
+			}
+			field.SetBytes(b)
+			break
+		}
+		delimiter := delimiterFrom(tag)
+		if tag.Get("decimal") == delimiter {
+			return fmt.Errorf("decimal:%q cannot be used with values separated by %q", delimiter, delimiter)
+		}
+		// an empty value means no elements rather than a single empty one,
+		// like it does for maps
+		if value == "" {
+			if o.nilEmptySlices {
+				field.Set(reflect.Zero(typ))
+			} else {
+				field.Set(reflect.MakeSlice(typ, 0, 0))
+			}
+			break
+		}
+		vals := splitEscaped(value, delimiter)
+		sl := reflect.MakeSlice(typ, len(vals), len(vals))
+		for i, val := range vals {
+			err := processField(o, val, sl.Index(i), tag)
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		field.Set(sl)
+	case reflect.Array:
+		delimiter := delimiterFrom(tag)
+		if tag.Get("decimal") == delimiter {
+			return fmt.Errorf("decimal:%q cannot be used with values separated by %q", delimiter, delimiter)
+		}
+		vals := splitEscaped(value, delimiter)
+		if len(vals) != typ.Len() {
+			return fmt.Errorf("expected %d values separated by %q, got %d", typ.Len(), delimiter, len(vals))
+		}
+		arr := reflect.New(typ).Elem()
+		for i, val := range vals {
+			err := processField(o, val, arr.Index(i), tag)
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+		}
+		field.Set(arr)
+	case reflect.Map:
+		if tag.Get("format") == "querystring" {
+			return processQueryString(o, value, field, tag)
+		}
+		delimiter := delimiterFrom(tag)
+		if tag.Get("decimal") == delimiter {
+			return fmt.Errorf("decimal:%q cannot be used with values separated by %q", delimiter, delimiter)
+		}
+		separator := tag.Get("separator")
+		if separator == "" {
+			separator = ":"
+		}
+		mp := reflect.MakeMap(typ)
+		if len(strings.TrimSpace(value)) != 0 {
+			pairs := splitEscaped(value, delimiter)
+			for _, pair := range pairs {
+				kvpair := strings.SplitN(pair, separator, 2)
+				if len(kvpair) != 2 {
+					return fmt.Errorf("invalid map item: %q", pair)
+				}
+				k := reflect.New(typ.Key()).Elem()
+				err := processField(o, kvpair[0], k, tag)
+				if err != nil {
+					return err
+				}
+				v := reflect.New(typ.Elem()).Elem()
+				err = processField(o, kvpair[1], v, tag)
+				if err != nil {
+					return err
+				}
+				mp.SetMapIndex(k, v)
+			}
+		}
+		field.Set(mp)
+	}
+
+	return nil
+}
+
+// processQueryString parses a query string such as a=1&b=2 into the map field.
+// Keys that are given more than once fill a slice value in order, and only
+// their first value is used otherwise.
+func processQueryString(o *options, value string, field reflect.Value, tag reflect.StructTag) error {
+	query, err := url.ParseQuery(value)
+	if err != nil {
+		return fmt.Errorf("invalid query string: %w", err)
+	}
+
+	typ := field.Type()
+	multi := typ.Elem().Kind() == reflect.Slice && typ.Elem().Elem().Kind() != reflect.Uint8
+	mp := reflect.MakeMap(typ)
+	for key, values := range query {
+		k := reflect.New(typ.Key()).Elem()
+		if err := processField(o, key, k, tag); err != nil {
+			return err
+		}
+		v := reflect.New(typ.Elem()).Elem()
+		if multi {
+			v.Set(reflect.MakeSlice(typ.Elem(), len(values), len(values)))
+			for i, val := range values {
+				if err := processField(o, val, v.Index(i), tag); err != nil {
+					return fmt.Errorf("%s: %w", key, err)
+				}
+			}
+		} else if err := processField(o, values[0], v, tag); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		mp.SetMapIndex(k, v)
+	}
+	field.Set(mp)
+	return nil
+}
+
+// delimiterFrom returns the separator between the elements of slices and
+// maps, which is a comma unless overridden with the delimiter tag.
+func delimiterFrom(tag reflect.StructTag) string {
+	if delimiter := tag.Get("delimiter"); delimiter != "" {
+		return delimiter
+	}
+	return ","
+}
+
+// splitEscaped splits value at every delimiter that isn't escaped with a
+// backslash. Only the backslashes right before a delimiter are escapes: a
+// backslash escapes the delimiter, and a pair of them stands for a backslash,
+// so that an element can end in one, as in C:\dir\\,D:\data. Other
+// backslashes, such as those of \\server\share, are kept as they are.
+func splitEscaped(value, delimiter string) []string {
+	if !strings.Contains(value, `\`) {
+		return strings.Split(value, delimiter)
+	}
+	var elems []string
+	var elem strings.Builder
+	for i := 0; i < len(value); {
+		switch {
+		case value[i] == '\\':
+			n := len(value[i:]) - len(strings.TrimLeft(value[i:], `\`))
+			if !strings.HasPrefix(value[i+n:], delimiter) {
+				elem.WriteString(value[i : i+n])
+				i += n
+				continue
+			}
+			elem.WriteString(strings.Repeat(`\`, n/2))
+			i += n
+			if n%2 == 1 {
+				elem.WriteString(delimiter)
+				i += len(delimiter)
+			}
+		case strings.HasPrefix(value[i:], delimiter):
+			elems = append(elems, elem.String())
+			elem.Reset()
+			i += len(delimiter)
+		default:
+			elem.WriteByte(value[i])
+			i++
+		}
+	}
+	return append(elems, elem.String())
+}
+
+// joinEscaped joins the elements of a slice or map with delimiter, escaping
+// them so that splitEscaped returns them as they are. Delimiters are escaped,
+// and the backslashes that splitEscaped would read as escapes are doubled:
+// those right before a delimiter or at the end of any element but the last.
+func joinEscaped(elems []string, delimiter string) string {
+	var b strings.Builder
+	for j, elem := range elems {
+		if j > 0 {
+			b.WriteString(delimiter)
+		}
+		for i := 0; i < len(elem); {
+			switch {
+			case elem[i] == '\\':
+				run := len(elem[i:]) - len(strings.TrimLeft(elem[i:], `\`))
+				rest, n := elem[i+run:], run
+				if strings.HasPrefix(rest, delimiter) || rest == "" && j < len(elems)-1 {
+					n *= 2
+				}
+				b.WriteString(strings.Repeat(`\`, n))
+				i += run
+			case strings.HasPrefix(elem[i:], delimiter):
+				b.WriteString(`\` + delimiter)
+				i += len(delimiter)
+			default:
+				b.WriteByte(elem[i])
+				i++
+			}
+		}
+	}
+	return b.String()
+}
+
+// decodeWith parses value with a registered decoder and assigns the result
+// to field.
+func decodeWith(fn DecodeFunc, value string, field reflect.Value) error {
+	v, err := fn(value)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(field.Type()) {
+		return fmt.Errorf("decoder returned %s, which is not assignable to %s", rv.Type(), field.Type())
+	}
+	field.Set(rv)
+	return nil
+}
+
+// isIgnored reports whether field is excluded from every layer, either by an
+// `ignored:"true"` tag or by a name override tag of "-".
+func isIgnored(o *options, field reflect.StructField) bool {
+	return field.Tag.Get("ignored") == "true" || field.Tag.Get(o.tagName) == "-"
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+
+// isOpaque reports whether fields of type t, such as interface{} and
+// json.RawMessage, hold a json blob that only config files can set. They are
+// skipped by the other layers unless a decoder is registered for them.
+func isOpaque(o *options, t reflect.Type) bool {
+	return (t.Kind() == reflect.Interface || t == rawMessageType) && !o.hasDecoder(t)
+}
+
+// isUnsupported reports whether fields of type t, such as channels and
+// functions, can't hold config at all. They are left untouched by every layer
+// but config files, which fail to decode them.
+func isUnsupported(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return true
+	}
+	return false
+}
+
+// jsonTagName returns the name given to a field by its json tag, if any.
+func jsonTagName(ftype reflect.StructField) string {
+	name := strings.Split(ftype.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// parseBool parses value like strconv.ParseBool, but also accepts words such as
+// yes and off in any case unless WithStrictBools is used.
+func parseBool(o *options, value string) (bool, error) {
+	if !o.strictBools {
+		switch strings.ToLower(value) {
+		case "yes", "y", "on", "enable", "enabled":
+			return true, nil
+		case "no", "n", "off", "disable", "disabled":
+			return false, nil
+		}
+	}
+	return strconv.ParseBool(value)
+}
+
+// matchOneOf checks value against the `oneof` tag, a space separated list of
+// the allowed values. An allowed value may be followed by aliases separated by
+// |, such as warn|warning, which are replaced with it. Values are compared
+// case-insensitively if the field is tagged with `ignore_case:"true"`, and are
+// then normalized to the spelling of the tag.
+func matchOneOf(value string, tag reflect.StructTag) (string, error) {
+	ignoreCase := tag.Get("ignore_case") == "true"
+	var allowed []string
+	for _, entry := range strings.Fields(tag.Get("oneof")) {
+		names := strings.Split(entry, "|")
+		for _, name := range names {
+			if name == value || ignoreCase && strings.EqualFold(name, value) {
+				return names[0], nil
+			}
+		}
+		allowed = append(allowed, names[0])
+	}
+	return "", fmt.Errorf("%q is not one of %s", value, strings.Join(allowed, ", "))
+}
+
+// decodeBytes decodes binary data such as keys and certificates, which is
+// given as standard or URL-safe base64 unless the `encoding` tag chooses hex,
+// with an optional 0x prefix, or raw for the bytes of the value itself.
+func decodeBytes(value string, tag reflect.StructTag) ([]byte, error) {
+	switch enc := tag.Get("encoding"); enc {
+	case "", "base64":
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			if b, err = base64.URLEncoding.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("expected base64: %s", err)
+			}
+		}
+		return b, nil
+	case "hex":
+		value = strings.TrimPrefix(strings.TrimPrefix(value, "0x"), "0X")
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("expected hex: %s", err)
+		}
+		return b, nil
+	case "raw":
+		return []byte(value), nil
+	default:
+		return nil, fmt.Errorf("unknown encoding:%q", enc)
+	}
+}
+
+// baseFrom returns the base integers are parsed in, as given by the `base`
+// tag. The default base of 0 detects it from prefixes such as 0x.
+func baseFrom(tag reflect.StructTag) (int, error) {
+	b := tag.Get("base")
+	if b == "" {
+		return 0, nil
+	}
+	base, err := strconv.Atoi(b)
+	if err != nil || base == 1 || base < 0 || base > 36 {
+		return 0, fmt.Errorf("invalid base:%q", b)
+	}
+	return base, nil
+}
+
+// hasCustomParser reports whether field parses itself, or is parsed by a
+// registered decoder, instead of being walked into as a nested struct.
+func hasCustomParser(o *options, field reflect.Value) bool {
+	return o.hasDecoder(field.Type()) || isStandardType(field.Type()) || isNullable(field.Type()) || decoderFrom(field) != nil || setterFrom(field) != nil || textUnmarshaler(field) != nil || binaryUnmarshaler(field) != nil
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	ipType     = reflect.TypeOf(net.IP{})
+	urlType    = reflect.TypeOf(url.URL{})
+	numberType = reflect.TypeOf(json.Number(""))
+)
+
+// isStandardType reports whether t is one of the standard library types that
+// processField parses natively.
+func isStandardType(t reflect.Type) bool {
+	return t == timeType || t == ipType || t == urlType || t == numberType
+}
+
+// isNullable reports whether t is one of the nullable types of database/sql,
+// such as sql.NullString or sql.Null[T]: a struct of an exported value field
+// followed by a Valid bool. Other structs of that shape are walked like any
+// other nested struct.
+func isNullable(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || t.PkgPath() != "database/sql" || t.NumField() != 2 {
+		return false
+	}
+	value, valid := t.Field(0), t.Field(1)
+	return valid.Name == "Valid" && valid.Type.Kind() == reflect.Bool && value.PkgPath == "" && !value.Anonymous
+}
+
+// parseStandardType parses value into field if it is a time.Time, net.IP,
+// url.URL or json.Number. Times are parsed as RFC3339 unless a `timeformat`
+// tag gives another layout, or unix or unixmilli for seconds or milliseconds
+// since the epoch.
+func parseStandardType(value string, field reflect.Value, tag reflect.StructTag) (bool, error) {
+	switch field.Type() {
+	case timeType:
+		layout := tag.Get("timeformat")
+		switch layout {
+		case "":
+			layout = time.RFC3339
+		case "unix", "unixmilli":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return true, fmt.Errorf("expected %s timestamp: %w", layout, err)
+			}
+			t := time.Unix(n, 0).UTC()
+			if layout == "unixmilli" {
+				t = time.UnixMilli(n).UTC()
+			}
+			field.Set(reflect.ValueOf(t))
+			return true, nil
+		}
+		// time.Parse assumes UTC rather than the local time zone when
+		// the layout has no zone, so config means the same on every host
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return true, err
+		}
+		field.Set(reflect.ValueOf(t))
+	case ipType:
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return true, fmt.Errorf("invalid IP address %q", value)
+		}
+		field.Set(reflect.ValueOf(ip))
+	case urlType:
+		u, err := url.Parse(value)
+		if err != nil {
+			return true, err
+		}
+		field.Set(reflect.ValueOf(*u))
+	case numberType:
+		// a json.Number holds the exact text of a number, which must be
+		// valid json
+		var n json.Number
+		if err := json.Unmarshal([]byte(value), &n); err != nil {
+			return true, fmt.Errorf("invalid number %q: %w", value, strconv.ErrSyntax)
+		}
+		field.Set(reflect.ValueOf(n))
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func interfaceFrom(field reflect.Value, fn func(interface{}, *bool)) {
+	// it may be impossible for a struct field to fail this check
+	if !field.CanInterface() {
+		return
+	}
+	var ok bool
+	fn(field.Interface(), &ok)
+	if !ok && field.CanAddr() {
+		fn(field.Addr().Interface(), &ok)
+	}
+}
+
+func decoderFrom(field reflect.Value) (d Decoder) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { d, *ok = v.(Decoder) })
+	return d
+}
+
+func setterFrom(field reflect.Value) (s Setter) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { s, *ok = v.(Setter) })
+	return s
+}
+
+func textUnmarshaler(field reflect.Value) (t encoding.TextUnmarshaler) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { t, *ok = v.(encoding.TextUnmarshaler) })
 	return t
 }
+
+func binaryUnmarshaler(field reflect.Value) (b encoding.BinaryUnmarshaler) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { b, *ok = v.(encoding.BinaryUnmarshaler) })
+	return b
+}
+
+func textMarshaler(field reflect.Value) (t encoding.TextMarshaler) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { t, *ok = v.(encoding.TextMarshaler) })
+	return t
+}
+
+func stringer(field reflect.Value) (s fmt.Stringer) {
+	interfaceFrom(field, func(v interface{}, ok *bool) { s, *ok = v.(fmt.Stringer) })
+	return s
+}
+
+// formatValue renders the value of a field for display. Types implementing
+// encoding.TextMarshaler are rendered with MarshalText, then types
+// implementing fmt.Stringer with String, and anything else as its raw value.
+// Nil pointers are rendered as an empty string.
+func formatValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t := textMarshaler(v); t != nil {
+		if text, err := t.MarshalText(); err == nil {
+			return string(text)
+		}
+	}
+	if s := stringer(v); s != nil {
+		return s.String()
+	}
+	return fmt.Sprint(v.Interface())
+}
@@ -5,10 +5,22 @@
 package kkonfig
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -264,12 +276,66 @@ func TestParseErrorUint(t *testing.T) {
 	}
 }
 
+func TestParseErrorUnwrap(t *testing.T) {
+	var s Specification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "99999999999999999999") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	if !errors.Is(err, ErrParse) {
+		t.Errorf("expected %v, got %v", ErrParse, err)
+	}
+	var numErr *strconv.NumError
+	if !errors.As(err, &numErr) {
+		t.Errorf("expected a *strconv.NumError, got %v", err)
+	}
+	if v, ok := err.(*ParseError); !ok || !v.IsRange() || v.IsSyntax() {
+		t.Errorf("expected a range ParseError, got %v", err)
+	}
+
+	if os.Setenv("ENV_CONFIG_PORT", "eighty") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || !v.IsSyntax() || v.IsRange() {
+		t.Errorf("expected a syntax ParseError, got %v", err)
+	}
+
+	var sizes struct {
+		Small int8 `format:"bytesize"`
+	}
+	if os.Setenv("ENV_CONFIG_SMALL", "1KB") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &sizes)
+	if v, ok := err.(*ParseError); !ok || !v.IsRange() {
+		t.Errorf("expected a range ParseError, got %v", err)
+	}
+	if errors.Is(ErrInvalidSpecification, ErrParse) {
+		t.Errorf("expected only ParseErrors to match ErrParse")
+	}
+}
+
 func TestErrInvalidSpecification(t *testing.T) {
 	m := make(map[string]string)
 	err := Process("env_config", nil, &m)
-	if err != ErrInvalidSpecification {
+	if !errors.Is(err, ErrInvalidSpecification) {
 		t.Errorf("expected %v, got %v", ErrInvalidSpecification, err)
 	}
+	if !strings.Contains(err.Error(), "got *map, want *struct") {
+		t.Errorf("expected %q to describe the specification", err.Error())
+	}
+
+	var s []string
+	err = Process("env_config", nil, s)
+	v, ok := err.(*InvalidSpecificationError)
+	if !ok {
+		t.Fatalf("expected InvalidSpecificationError, got %v", err)
+	}
+	if v.Kind != reflect.Slice || v.Pointer {
+		t.Errorf("expected %v, got %v", reflect.Slice, v.Kind)
+	}
 }
 
 func TestUnsetVars(t *testing.T) {
@@ -447,6 +513,58 @@ func TestRequiredDefault(t *testing.T) {
 	}
 }
 
+func TestRequiredError(t *testing.T) {
+	var s struct {
+		DatabaseURL string `required:"true" desc:"the primary Postgres DSN" example:"postgres://localhost/app"`
+	}
+	os.Clearenv()
+	err := Process("", nil, &s)
+	v, ok := err.(*RequiredError)
+	if !ok {
+		t.Fatalf("expected RequiredError, got %v", err)
+	}
+	if v.KeyName != "DATABASEURL" {
+		t.Errorf("expected %s, got %s", "DATABASEURL", v.KeyName)
+	}
+	if v.FieldName != "DatabaseURL" {
+		t.Errorf("expected %s, got %s", "DatabaseURL", v.FieldName)
+	}
+	expected := "kkonfig: missing required DATABASEURL (the primary Postgres DSN), e.g. DATABASEURL=postgres://localhost/app"
+	if err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestRequiredFromAnyLayer(t *testing.T) {
+	type spec struct {
+		Host string `required:"true"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "json"}`)
+
+	// a value that no layer provided does not count
+	s := spec{Host: "preset"}
+	if _, ok := Process("env_config", nil, &s).(*RequiredError); !ok {
+		t.Error("expected a RequiredError for a value no layer provided")
+	}
+
+	s = spec{}
+	if err := Process("env_config", []string{path}, &s); err != nil {
+		t.Errorf("expected a value from json to satisfy required, got %s", err)
+	}
+
+	s = spec{}
+	src := mapLookuper{"ENV_CONFIG_HOST": "source"}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithConfigSource(src, SourceAfterEnv)); err != nil {
+		t.Errorf("expected a value from a config source to satisfy required, got %s", err)
+	}
+}
+
 func TestPointerFieldBlank(t *testing.T) {
 	var s Specification
 	os.Clearenv()
@@ -589,7 +707,7 @@ func TestNonPointerFailsProperly(t *testing.T) {
 	}
 
 	err := Process("env_config", nil, s)
-	if err != ErrInvalidSpecification {
+	if !errors.Is(err, ErrInvalidSpecification) {
 		t.Errorf("non-pointer should fail with ErrInvalidSpecification, was instead %s", err)
 	}
 }
@@ -709,6 +827,189 @@ func TestEmptyPrefixUsesFieldNames(t *testing.T) {
 	}
 }
 
+func TestProcessStrict(t *testing.T) {
+	var s struct {
+		Host     string
+		Port     int    `deprecated:"ENV_CONFIG_LISTEN_PORT"`
+		Password string `file:"ENV_CONFIG_PASSWORD_FILE"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_HOST":        "localhost",
+		"ENV_CONFIG_LISTEN_PORT": "8080",
+		"OTHER_HOST":             "unrelated",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessStrict("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if os.Setenv("ENV_CONFIG_HSOT", "typo") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_DEBUG", "true") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := ProcessStrict("env_config", nil, &s)
+	if expected := "kkonfig: unknown environment variables: ENV_CONFIG_DEBUG, ENV_CONFIG_HSOT"; err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Errorf("expected unknown variables to be allowed by Process, got %v", err)
+	}
+
+	// the elements of slices of structs that config files provide are known
+	var c struct {
+		Servers []struct {
+			Port int
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := writeConfigFile(t, dir, "config.json", `{"Servers": [{"Port": 1}]}`)
+	if os.Setenv("ENV_CONFIG_SERVERS_0_PORT", "2") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessStrict("env_config", []string{config}, &c); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(c.Servers) != 1 || c.Servers[0].Port != 2 {
+		t.Errorf("expected %v, got %v", []int{2}, c.Servers)
+	}
+	if os.Setenv("ENV_CONFIG_SERVERS_1_PORT", "3") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = ProcessStrict("env_config", []string{config}, &c)
+	if expected := "kkonfig: unknown environment variables: ENV_CONFIG_SERVERS_1_PORT"; err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
+
+func TestStructSlices(t *testing.T) {
+	type server struct {
+		Host string
+		Port int `default:"80"`
+		Tags []struct {
+			Name string
+		}
+	}
+	var s struct {
+		Servers []server
+		Backups []*server
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "config.json", `{
+		"Servers": [{"Host": "a", "Port": 8080}, {"Host": "b", "Port": 8081}],
+		"Backups": [{"Host": "x"}, {"Host": "y"}]
+	}`)
+	for key, value := range map[string]string{
+		"ENV_CONFIG_SERVERS_1_PORT":        "9090",
+		"ENV_CONFIG_SERVERS_COUNT":         "3",
+		"ENV_CONFIG_SERVERS_2_HOST":        "c",
+		"ENV_CONFIG_SERVERS_2_TAGS_COUNT":  "1",
+		"ENV_CONFIG_SERVERS_2_TAGS_0_NAME": "new",
+		"ENV_CONFIG_SERVERS_5_HOST":        "out of range",
+		"ENV_CONFIG_BACKUPS_COUNT":         "1",
+		"ENV_CONFIG_BACKUPS_0_HOST":        "z",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+
+	report, err := ProcessWithReport("env_config", []string{path}, &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(s.Servers) != 3 {
+		t.Fatalf("expected %d servers, got %v", 3, s.Servers)
+	}
+	if s.Servers[0].Host != "a" || s.Servers[0].Port != 8080 {
+		t.Errorf("expected %s:%d, got %+v", "a", 8080, s.Servers[0])
+	}
+	if s.Servers[1].Host != "b" || s.Servers[1].Port != 9090 {
+		t.Errorf("expected %s:%d, got %+v", "b", 9090, s.Servers[1])
+	}
+	if s.Servers[2].Host != "c" || s.Servers[2].Port != 80 {
+		t.Errorf("expected %s:%d, got %+v", "c", 80, s.Servers[2])
+	}
+	if len(s.Servers[2].Tags) != 1 || s.Servers[2].Tags[0].Name != "new" {
+		t.Errorf("expected tag %s, got %v", "new", s.Servers[2].Tags)
+	}
+	if len(s.Backups) != 1 || s.Backups[0].Host != "z" {
+		t.Errorf("expected backup %s, got %v", "z", s.Backups)
+	}
+	if expected := (Origin{Source: SourceFile, Location: path}); report["Servers[0].Host"] != expected {
+		t.Errorf("expected %v, got %v", expected, report["Servers[0].Host"])
+	}
+	if expected := (Origin{Source: SourceEnv, Location: "ENV_CONFIG_SERVERS_1_PORT"}); report["Servers[1].Port"] != expected {
+		t.Errorf("expected %v, got %v", expected, report["Servers[1].Port"])
+	}
+
+	if os.Setenv("ENV_CONFIG_SERVERS_COUNT", "-1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", []string{path}, &s)
+	if v, ok := err.(*ParseError); !ok || v.KeyName != "ENV_CONFIG_SERVERS_COUNT" {
+		t.Errorf("expected ParseError for ENV_CONFIG_SERVERS_COUNT, got %v", err)
+	}
+}
+
+func TestPrefixTag(t *testing.T) {
+	type cacheConfig struct {
+		Host string
+		Port int
+	}
+	type TLS struct {
+		Cert string
+	}
+	var s struct {
+		Cache cacheConfig  `prefix:"redis"`
+		Queue *cacheConfig `prefix:""`
+		Store cacheConfig
+		TLS   `prefix:"tls"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"REDIS_HOST":            "redis",
+		"ENV_CONFIG_CACHE_HOST": "wrong",
+		"PORT":                  "5672",
+		"ENV_CONFIG_STORE_HOST": "store",
+		"TLS_CERT":              "cert.pem",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Cache.Host != "redis" {
+		t.Errorf("expected %s, got %s", "redis", s.Cache.Host)
+	}
+	if s.Queue == nil || s.Queue.Port != 5672 {
+		t.Errorf("expected %d, got %v", 5672, s.Queue)
+	}
+	if s.Store.Host != "store" {
+		t.Errorf("expected %s, got %s", "store", s.Store.Host)
+	}
+	if s.Cert != "cert.pem" {
+		t.Errorf("expected %s, got %s", "cert.pem", s.Cert)
+	}
+}
+
 func TestNestedStructVarName(t *testing.T) {
 	var s Specification
 	os.Clearenv()
@@ -762,31 +1063,1627 @@ func TestTextUnmarshalerError(t *testing.T) {
 	}
 }
 
-type bracketed string
+func TestContainerDefaults(t *testing.T) {
+	var s struct {
+		Tags     []string          `default:"a,b,c"`
+		Weights  map[string]int    `default:"x:1,y:2"`
+		Pair     [2]int            `default:"1,2"`
+		Hosts    []string          `default:"[]"`
+		Labels   map[string]string `default:"{}"`
+		Optional *[]int            `default:"[]"`
+		Database struct {
+			Host  string `default:"localhost"`
+			Ports []int  `default:"5432,5433"`
+			Cache *struct {
+				Size int `default:"64"`
+			}
+		}
+	}
+	os.Clearenv()
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithNilEmptySlices()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(s.Tags, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Tags)
+	}
+	if expected := map[string]int{"x": 1, "y": 2}; !reflect.DeepEqual(s.Weights, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Weights)
+	}
+	if expected := [2]int{1, 2}; s.Pair != expected {
+		t.Errorf("expected %v, got %v", expected, s.Pair)
+	}
+	// [] and {} are explicitly empty, even with WithNilEmptySlices
+	if s.Hosts == nil || len(s.Hosts) != 0 {
+		t.Errorf("expected an empty slice, got %#v", s.Hosts)
+	}
+	if s.Labels == nil || len(s.Labels) != 0 {
+		t.Errorf("expected an empty map, got %#v", s.Labels)
+	}
+	if s.Optional == nil || *s.Optional == nil || len(*s.Optional) != 0 {
+		t.Errorf("expected a pointer to an empty slice, got %#v", s.Optional)
+	}
+	if s.Database.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Database.Host)
+	}
+	if expected := []int{5432, 5433}; !reflect.DeepEqual(s.Database.Ports, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Database.Ports)
+	}
+	if s.Database.Cache == nil || s.Database.Cache.Size != 64 {
+		t.Errorf("expected %d, got %+v", 64, s.Database.Cache)
+	}
+}
 
-func (b *bracketed) Set(value string) error {
-	*b = bracketed("[" + value + "]")
-	return nil
+func TestEmptySlices(t *testing.T) {
+	var s struct {
+		Tags  []string `default:"a,b"`
+		Ports []int
+		One   []string
+		Many  []string
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_TAGS":  "",
+		"ENV_CONFIG_PORTS": "",
+		"ENV_CONFIG_ONE":   "a",
+		"ENV_CONFIG_MANY":  "a,,b",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Tags == nil || len(s.Tags) != 0 {
+		t.Errorf("expected an empty slice, got %#v", s.Tags)
+	}
+	if s.Ports == nil || len(s.Ports) != 0 {
+		t.Errorf("expected an empty slice, got %#v", s.Ports)
+	}
+	if expected := []string{"a"}; !reflect.DeepEqual(s.One, expected) {
+		t.Errorf("expected %#v, got %#v", expected, s.One)
+	}
+	if expected := []string{"a", "", "b"}; !reflect.DeepEqual(s.Many, expected) {
+		t.Errorf("expected %#v, got %#v", expected, s.Many)
+	}
+
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithNilEmptySlices()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Tags != nil || s.Ports != nil {
+		t.Errorf("expected nil slices, got %#v and %#v", s.Tags, s.Ports)
+	}
 }
 
-func (b bracketed) String() string {
-	return string(b)
+func TestVerbatimAndEscapedValues(t *testing.T) {
+	var s struct {
+		Cert   string
+		Paths  []string
+		Shares []string
+		Greets []string
+		Labels map[string]string
+		Pair   [2]string `delimiter:";"`
+	}
+	cert := "-----BEGIN CERTIFICATE-----\r\nMIIB\\+/=\n-----END CERTIFICATE-----\n"
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_CERT":   cert,
+		"ENV_CONFIG_PATHS":  `C:\Program Files\app\\,D:\data\`,
+		"ENV_CONFIG_SHARES": `\\server\share,\\other\share`,
+		"ENV_CONFIG_GREETS": `hello\, world,bye`,
+		"ENV_CONFIG_LABELS": `a:1\,2,b:3`,
+		"ENV_CONFIG_PAIR":   `x\;y;z`,
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Cert != cert {
+		t.Errorf("expected %q, got %q", cert, s.Cert)
+	}
+	if expected := []string{`C:\Program Files\app\`, `D:\data\`}; !reflect.DeepEqual(s.Paths, expected) {
+		t.Errorf("expected %q, got %q", expected, s.Paths)
+	}
+	if expected := []string{`\\server\share`, `\\other\share`}; !reflect.DeepEqual(s.Shares, expected) {
+		t.Errorf("expected %q, got %q", expected, s.Shares)
+	}
+	if expected := []string{"hello, world", "bye"}; !reflect.DeepEqual(s.Greets, expected) {
+		t.Errorf("expected %q, got %q", expected, s.Greets)
+	}
+	if expected := map[string]string{"a": "1,2", "b": "3"}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %q, got %q", expected, s.Labels)
+	}
+	if expected := [2]string{"x;y", "z"}; s.Pair != expected {
+		t.Errorf("expected %q, got %q", expected, s.Pair)
+	}
+
+	env, err := Dump("env_config", &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := `hello\, world,bye`; env["ENV_CONFIG_GREETS"] != expected {
+		t.Errorf("expected %q, got %q", expected, env["ENV_CONFIG_GREETS"])
+	}
+	if expected := `a:1\,2,b:3`; env["ENV_CONFIG_LABELS"] != expected {
+		t.Errorf("expected %q, got %q", expected, env["ENV_CONFIG_LABELS"])
+	}
+
+	// elements ending in or made of backslashes survive a round trip
+	for _, paths := range [][]string{
+		{`C:\dir\`, `D:\`},
+		{`\\server\share`, `a\,b`, `\`, `x\\`},
+		{`\\server\share\`, `\\other\share\\`},
+	} {
+		s.Paths = paths
+		env, err := Dump("env_config", &s)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		s.Paths = nil
+		if err := ProcessMap("env_config", env, &s); err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(s.Paths, paths) {
+			t.Errorf("expected %q, got %q from %q", paths, s.Paths, env["ENV_CONFIG_PATHS"])
+		}
+	}
 }
 
-// quoted is used to test the precedence of Decode over Set.
-// The sole field is a flag.Value rather than a setter to validate that
-// all flag.Value implementations are also Setter implementations.
-type quoted struct{ flag.Value }
+func TestCustomSliceElements(t *testing.T) {
+	var s struct {
+		Bars  []bracketed
+		Times []time.Time
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BARS", "a,b") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TIMES", "2016-08-16T18:57:05Z,2017-08-16T18:57:05Z") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Error(err.Error())
+	}
 
-func (d quoted) Decode(value string) error {
-	return d.Set(`"` + value + `"`)
+	if len(s.Bars) != 2 || s.Bars[0] != "[a]" || s.Bars[1] != "[b]" {
+		t.Errorf("expected %#v, got %#v", []bracketed{"[a]", "[b]"}, s.Bars)
+	}
+	if len(s.Times) != 2 || s.Times[1].Year() != 2017 {
+		t.Errorf("expected two times ending in 2017, got %v", s.Times)
+	}
 }
 
-type setterStruct struct {
-	Inner string
+func TestCustomSliceType(t *testing.T) {
+	var s struct {
+		Hosts    semicolonList
+		HostsPtr *semicolonList
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_HOSTS", "a,b;c") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_HOSTSPTR", "d;e,f") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Error(err.Error())
+	}
+
+	if len(s.Hosts) != 2 || s.Hosts[0] != "a,b" || s.Hosts[1] != "c" {
+		t.Errorf("expected %#v, got %#v", semicolonList{"a,b", "c"}, s.Hosts)
+	}
+	if s.HostsPtr == nil || len(*s.HostsPtr) != 2 || (*s.HostsPtr)[1] != "e,f" {
+		t.Errorf("expected %#v, got %#v", semicolonList{"d", "e,f"}, s.HostsPtr)
+	}
 }
 
-func (ss *setterStruct) Set(value string) error {
-	ss.Inner = fmt.Sprintf("setterstruct{%q}", value)
-	return nil
+func TestMapFields(t *testing.T) {
+	var s struct {
+		Labels   map[string]string
+		Limits   map[string]int
+		Timeouts map[string]time.Duration
+		Empty    map[string]string
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_LABELS", "app:web,tier:frontend") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_LIMITS", "a:1,b:2,c:3") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TIMEOUTS", "read:5s,write:1m") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_EMPTY", "") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := map[string]string{"app": "web", "tier": "frontend"}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Labels)
+	}
+	if expected := map[string]int{"a": 1, "b": 2, "c": 3}; !reflect.DeepEqual(s.Limits, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Limits)
+	}
+	if expected := map[string]time.Duration{"read": 5 * time.Second, "write": time.Minute}; !reflect.DeepEqual(s.Timeouts, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Timeouts)
+	}
+	if s.Empty == nil || len(s.Empty) != 0 {
+		t.Errorf("expected an empty map, got %#v", s.Empty)
+	}
+}
+
+func TestMapFieldsMalformed(t *testing.T) {
+	var s struct {
+		Limits map[string]int
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_LIMITS", "a:1,b") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.FieldName != "Limits" {
+		t.Errorf("expected %s, got %s", "Limits", v.FieldName)
+	}
+
+	if os.Setenv("ENV_CONFIG_LIMITS", "a:one") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Error("expected ParseError for a value of the wrong type")
+	}
+}
+
+func TestDelimiter(t *testing.T) {
+	var s struct {
+		DSNs   []string          `delimiter:";"`
+		Rates  []float64         `delimiter:";" decimal:","`
+		Labels map[string]string `delimiter:";" separator:"="`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_DSNS", "host=a,port=1;host=b,port=2") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_RATES", "3,14;2,5") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_LABELS", "app=web,api;tier=frontend") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := []string{"host=a,port=1", "host=b,port=2"}; !reflect.DeepEqual(s.DSNs, expected) {
+		t.Errorf("expected %#v, got %#v", expected, s.DSNs)
+	}
+	if expected := []float64{3.14, 2.5}; !reflect.DeepEqual(s.Rates, expected) {
+		t.Errorf("expected %#v, got %#v", expected, s.Rates)
+	}
+	if expected := map[string]string{"app": "web,api", "tier": "frontend"}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %#v, got %#v", expected, s.Labels)
+	}
+}
+
+func TestDecimalSeparator(t *testing.T) {
+	var s struct {
+		Rate    float64 `decimal:","`
+		Ratio   float32 `decimal:","`
+		Default float64 `decimal:"," default:"2,5"`
+		Plain   float64
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_RATE", "3,14") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_RATIO", "0.5") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PLAIN", "1.5") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Rate != 3.14 {
+		t.Errorf("expected %v, got %v", 3.14, s.Rate)
+	}
+	if s.Ratio != 0.5 {
+		t.Errorf("expected %v, got %v", 0.5, s.Ratio)
+	}
+	if s.Default != 2.5 {
+		t.Errorf("expected %v, got %v", 2.5, s.Default)
+	}
+	if s.Plain != 1.5 {
+		t.Errorf("expected %v, got %v", 1.5, s.Plain)
+	}
+
+	if os.Setenv("ENV_CONFIG_PLAIN", "1,5") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Error("expected a ParseError for a decimal comma without the tag")
+	}
+}
+
+func TestDecimalSeparatorSlice(t *testing.T) {
+	var s struct {
+		Rates []float64 `decimal:","`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_RATES", "3,14") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Error("expected a ParseError for a decimal comma in a comma separated slice")
+	}
+}
+
+func TestProcessMany(t *testing.T) {
+	var server struct {
+		Port int
+	}
+	var database struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "db.local"}`)
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessMany("env_config", []string{path}, &server, &database); err != nil {
+		t.Fatal(err.Error())
+	}
+	if server.Port != 8080 || database.Port != 8080 {
+		t.Errorf("expected both ports to be %d, got %d and %d", 8080, server.Port, database.Port)
+	}
+	if database.Host != "db.local" {
+		t.Errorf("expected %s, got %s", "db.local", database.Host)
+	}
+
+	var broken struct {
+		Port bool
+	}
+	err = ProcessMany("env_config", nil, &server, &broken)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), "spec 1") {
+		t.Errorf("expected the error to name spec 1, got %s", err)
+	}
+	var v *ParseError
+	if !errors.As(err, &v) || v.FieldName != "Port" {
+		t.Errorf("expected a ParseError for Port, got %v", err)
+	}
+}
+
+type logLevel int
+
+func (l logLevel) String() string {
+	return [...]string{"debug", "info", "warn", "error"}[l]
+}
+
+func TestFormatValue(t *testing.T) {
+	level := logLevel(2)
+	var nilLevel *logLevel
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{8080, "8080"},
+		{"foo", "foo"},
+		{2 * time.Minute, "2m0s"},
+		{level, "warn"},
+		{&level, "warn"},
+		{nilLevel, ""},
+		// TextMarshaler takes precedence over Stringer
+		{time.Date(2016, 8, 16, 18, 57, 5, 0, time.UTC), "2016-08-16T18:57:05Z"},
+	}
+	for _, test := range tests {
+		if got := formatValue(reflect.ValueOf(test.value)); got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+func writeConfigFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("Unable to write %s: %s", path, err)
+	}
+	return path
+}
+
+func TestJsonBase(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.Mkdir(filepath.Join(dir, "env"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeConfigFile(t, dir, "common.json", `{"Host": "localhost", "Port": 80, "User": "common"}`)
+	writeConfigFile(t, dir, "env/staging.json", `{"base": "../common.json", "Port": 8080}`)
+	prod := writeConfigFile(t, dir, "env/prod.json", `{"base": "staging.json", "User": "prod"}`)
+
+	if err := Process("env_config", []string{prod}, &s); err != nil {
+		t.Error(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "prod" {
+		t.Errorf("expected %s, got %s", "prod", s.User)
+	}
+
+	// the header isn't read into a field of the same name
+	var b struct {
+		Base string
+		Port int
+	}
+	if err := Process("env_config", []string{prod}, &b); err != nil {
+		t.Error(err.Error())
+	}
+	if b.Base != "" {
+		t.Errorf("expected an empty Base, got %s", b.Base)
+	}
+	if b.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, b.Port)
+	}
+}
+
+func TestJsonBaseCycle(t *testing.T) {
+	var s struct {
+		Host string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := writeConfigFile(t, dir, "a.json", `{"base": "b.json", "Host": "a"}`)
+	writeConfigFile(t, dir, "b.json", `{"base": "a.json", "Host": "b"}`)
+
+	if err := Process("env_config", []string{a}, &s); err == nil {
+		t.Error("expected an error for a base cycle")
+	}
+}
+
+type bracketed string
+
+func (b *bracketed) Set(value string) error {
+	*b = bracketed("[" + value + "]")
+	return nil
+}
+
+func (b bracketed) String() string {
+	return string(b)
+}
+
+// quoted is used to test the precedence of Decode over Set.
+// The sole field is a flag.Value rather than a setter to validate that
+// all flag.Value implementations are also Setter implementations.
+type quoted struct{ flag.Value }
+
+func (d quoted) Decode(value string) error {
+	return d.Set(`"` + value + `"`)
+}
+
+type setterStruct struct {
+	Inner string
+}
+
+func (ss *setterStruct) Set(value string) error {
+	ss.Inner = fmt.Sprintf("setterstruct{%q}", value)
+	return nil
+}
+
+// semicolonList parses itself, splitting on semicolons rather than commas.
+type semicolonList []string
+
+func (l *semicolonList) Set(value string) error {
+	*l = strings.Split(value, ";")
+	return nil
+}
+
+func TestStandardTypes(t *testing.T) {
+	var s struct {
+		Started  time.Time `timeformat:"2006-01-02"`
+		Expires  *time.Time
+		Address  net.IP
+		Endpoint url.URL
+		Proxy    *url.URL
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_STARTED", "2016-08-16") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_EXPIRES", "2016-08-16T18:57:05Z") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_ADDRESS", "10.0.0.1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_ENDPOINT", "https://example.com/api?v=1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PROXY", "http://proxy:3128") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if expected := time.Date(2016, 8, 16, 0, 0, 0, 0, time.UTC); !s.Started.Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, s.Started)
+	}
+	if expected := time.Date(2016, 8, 16, 18, 57, 5, 0, time.UTC); s.Expires == nil || !s.Expires.Equal(expected) {
+		t.Errorf("expected %s, got %v", expected, s.Expires)
+	}
+	if !s.Address.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("expected %s, got %s", "10.0.0.1", s.Address)
+	}
+	if s.Endpoint.Host != "example.com" || s.Endpoint.Path != "/api" || s.Endpoint.RawQuery != "v=1" {
+		t.Errorf("expected %s, got %s", "https://example.com/api?v=1", s.Endpoint.String())
+	}
+	if s.Proxy == nil || s.Proxy.String() != "http://proxy:3128" {
+		t.Errorf("expected %s, got %v", "http://proxy:3128", s.Proxy)
+	}
+}
+
+func TestUnixTimes(t *testing.T) {
+	var s struct {
+		Started time.Time   `timeformat:"unix"`
+		Expires *time.Time  `timeformat:"unixmilli"`
+		Ticks   []time.Time `timeformat:"unix"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_STARTED": "1471312800",
+		"ENV_CONFIG_EXPIRES": "1471312800123",
+		"ENV_CONFIG_TICKS":   "0,-60",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := time.Date(2016, 8, 16, 2, 0, 0, 0, time.UTC); s.Started != expected {
+		t.Errorf("expected %s, got %s", expected, s.Started)
+	}
+	if expected := time.Date(2016, 8, 16, 2, 0, 0, 123e6, time.UTC); s.Expires == nil || *s.Expires != expected {
+		t.Errorf("expected %s, got %v", expected, s.Expires)
+	}
+	if expected := []time.Time{time.Unix(0, 0).UTC(), time.Unix(-60, 0).UTC()}; !reflect.DeepEqual(s.Ticks, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Ticks)
+	}
+
+	env, err := Dump("env_config", &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if env["ENV_CONFIG_EXPIRES"] != "1471312800123" {
+		t.Errorf("expected %s, got %s", "1471312800123", env["ENV_CONFIG_EXPIRES"])
+	}
+
+	if os.Setenv("ENV_CONFIG_STARTED", "2016-08-16T02:00:00Z") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.FieldName != "Started" || !strings.Contains(v.Error(), "expected unix timestamp") {
+		t.Errorf("expected ParseError for Started, got %v", err)
+	}
+}
+
+func TestNullableTypes(t *testing.T) {
+	var s struct {
+		Name    sql.NullString
+		MaxRows sql.NullInt64 `default:"100"`
+		Debug   sql.NullBool
+		Ratio   *sql.NullFloat64
+		Started sql.NullTime `timeformat:"unix"`
+		Comment sql.NullString
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_NAME":    "",
+		"ENV_CONFIG_RATIO":   "0.5",
+		"ENV_CONFIG_STARTED": "1471312800",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := (sql.NullString{Valid: true}); s.Name != expected {
+		t.Errorf("expected %v, got %v", expected, s.Name)
+	}
+	if expected := (sql.NullInt64{Int64: 100, Valid: true}); s.MaxRows != expected {
+		t.Errorf("expected %v, got %v", expected, s.MaxRows)
+	}
+	if s.Debug.Valid {
+		t.Errorf("expected Debug to be null, got %v", s.Debug)
+	}
+	if expected := (sql.NullFloat64{Float64: 0.5, Valid: true}); s.Ratio == nil || *s.Ratio != expected {
+		t.Errorf("expected %v, got %v", expected, s.Ratio)
+	}
+	if expected := time.Date(2016, 8, 16, 2, 0, 0, 0, time.UTC); !s.Started.Valid || s.Started.Time != expected {
+		t.Errorf("expected %s, got %v", expected, s.Started)
+	}
+
+	env, err := Dump("env_config", &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for key, expected := range map[string]string{
+		"ENV_CONFIG_MAXROWS": "100",
+		"ENV_CONFIG_STARTED": "1471312800",
+	} {
+		if env[key] != expected {
+			t.Errorf("expected %q for %s, got %q", expected, key, env[key])
+		}
+	}
+	if value, ok := env["ENV_CONFIG_DEBUG"]; ok {
+		t.Errorf("expected ENV_CONFIG_DEBUG to be left out, got %q", value)
+	}
+	s.Ratio.Valid = false
+	if env, err = Dump("env_config", &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if value, ok := env["ENV_CONFIG_RATIO"]; ok {
+		t.Errorf("expected ENV_CONFIG_RATIO to be left out, got %q", value)
+	}
+
+	if os.Setenv("ENV_CONFIG_DEBUG", "maybe") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.FieldName != "Debug" {
+		t.Errorf("expected ParseError for Debug, got %v", err)
+	}
+}
+
+func TestNullableLookalikes(t *testing.T) {
+	var s struct {
+		TLS struct {
+			Cert  string
+			Valid bool
+		}
+		Limit sql.Null[int]
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_TLS_CERT":  "server.pem",
+		"ENV_CONFIG_TLS_VALID": "true",
+		"ENV_CONFIG_LIMIT":     "10",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.TLS.Cert != "server.pem" || !s.TLS.Valid {
+		t.Errorf("expected TLS to be read as a nested struct, got %+v", s.TLS)
+	}
+	if expected := (sql.Null[int]{V: 10, Valid: true}); s.Limit != expected {
+		t.Errorf("expected %v, got %v", expected, s.Limit)
+	}
+	expected := []string{"ENV_CONFIG_TLS_CERT", "ENV_CONFIG_TLS_VALID", "ENV_CONFIG_LIMIT"}
+	if keys := Keys("env_config", &s); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestTimeSlices(t *testing.T) {
+	var s struct {
+		Windows []time.Time `timeformat:"2006-01-02 15:04" delimiter:";"`
+		Offsets [2]time.Time
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_WINDOWS", "2016-08-16 02:00;2016-08-23 02:30") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_OFFSETS", "2016-08-16T02:00:00+02:00,2016-08-16T02:00:00Z") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := []time.Time{
+		time.Date(2016, 8, 16, 2, 0, 0, 0, time.UTC),
+		time.Date(2016, 8, 23, 2, 30, 0, 0, time.UTC),
+	}
+	if len(s.Windows) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, s.Windows)
+	}
+	for i, w := range s.Windows {
+		if !w.Equal(expected[i]) || w.Location() != time.UTC {
+			t.Errorf("expected %s, got %s", expected[i], w)
+		}
+	}
+	if expected := time.Date(2016, 8, 16, 0, 0, 0, 0, time.UTC); !s.Offsets[0].Equal(expected) {
+		t.Errorf("expected %s, got %s", expected, s.Offsets[0])
+	}
+
+	if os.Setenv("ENV_CONFIG_WINDOWS", "2016-08-16 02:00;tomorrow") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.FieldName != "Windows" || !strings.Contains(v.Error(), "element 1") {
+		t.Errorf("expected ParseError naming element 1 of Windows, got %v", err)
+	}
+}
+
+func TestStandardTypeErrors(t *testing.T) {
+	for key, value := range map[string]string{
+		"ENV_CONFIG_STARTED":  "16/08/2016",
+		"ENV_CONFIG_ADDRESS":  "10.0.0.256",
+		"ENV_CONFIG_ENDPOINT": "http://[::1",
+	} {
+		var s struct {
+			Started  time.Time `timeformat:"2006-01-02"`
+			Address  net.IP
+			Endpoint url.URL
+		}
+		os.Clearenv()
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+		err := Process("env_config", nil, &s)
+		v, ok := err.(*ParseError)
+		if !ok {
+			t.Errorf("expected ParseError for %s, got %v", key, err)
+			continue
+		}
+		if v.KeyName != key {
+			t.Errorf("expected %s, got %s", key, v.KeyName)
+		}
+	}
+}
+
+func TestFileTag(t *testing.T) {
+	var s struct {
+		Password string `file:"DB_PASSWORD_FILE"`
+		Token    string `file:"TOKEN_FILE"`
+		Port     int    `file:"PORT_FILE" default:"5432"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "db-password", "hunter2\n")
+	if os.Setenv("DB_PASSWORD_FILE", path) != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PASSWORD", "from-env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TOKEN", "token") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Password != "hunter2" {
+		t.Errorf("expected %s, got %s", "hunter2", s.Password)
+	}
+	if s.Token != "token" {
+		t.Errorf("expected %s, got %s", "token", s.Token)
+	}
+	if s.Port != 5432 {
+		t.Errorf("expected %d, got %d", 5432, s.Port)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	if os.Setenv("TOKEN_FILE", missing) != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &s)
+	v, ok := err.(*ConfigFileError)
+	if !ok {
+		t.Fatalf("expected ConfigFileError, got %v", err)
+	}
+	if v.Path != missing {
+		t.Errorf("expected %s, got %s", missing, v.Path)
+	}
+
+	// with WithFS the file is read from that filesystem
+	os.Clearenv()
+	if os.Setenv("DB_PASSWORD_FILE", "secrets/password") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	fsys := fstest.MapFS{
+		"secrets/password": {Data: []byte("from-fs\n")},
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithFS(fsys)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Password != "from-fs" {
+		t.Errorf("expected %s, got %s", "from-fs", s.Password)
+	}
+}
+
+func TestByteSlices(t *testing.T) {
+	var s struct {
+		Key    []byte
+		Cert   []byte
+		Secret []byte
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_KEY", "aGVsbG8gd29ybGQ=") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_CERT", "_-8=") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(s.Key) != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", s.Key)
+	}
+	if expected := []byte{0xff, 0xef}; !reflect.DeepEqual(s.Cert, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Cert)
+	}
+
+	if os.Setenv("ENV_CONFIG_SECRET", "not base64!") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.FieldName != "Secret" {
+		t.Errorf("expected %s, got %s", "Secret", v.FieldName)
+	}
+	if !strings.Contains(v.Error(), "base64") {
+		t.Errorf("expected %q to mention base64", v.Error())
+	}
+}
+
+func TestByteEncodings(t *testing.T) {
+	var s struct {
+		Hex      []byte `encoding:"hex"`
+		Prefixed []byte `encoding:"hex"`
+		Raw      []byte `encoding:"raw"`
+		Base64   []byte `encoding:"base64"`
+		Unknown  []byte `encoding:"base32"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_HEX":      "deadbeef",
+		"ENV_CONFIG_PREFIXED": "0xCAFE",
+		"ENV_CONFIG_RAW":      "hello world",
+		"ENV_CONFIG_BASE64":   "aGk=",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := []byte{0xde, 0xad, 0xbe, 0xef}; !reflect.DeepEqual(s.Hex, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Hex)
+	}
+	if expected := []byte{0xca, 0xfe}; !reflect.DeepEqual(s.Prefixed, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Prefixed)
+	}
+	if string(s.Raw) != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", s.Raw)
+	}
+	if string(s.Base64) != "hi" {
+		t.Errorf("expected %q, got %q", "hi", s.Base64)
+	}
+
+	if os.Setenv("ENV_CONFIG_HEX", "xyz") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.FieldName != "Hex" || !strings.Contains(v.Error(), "hex") {
+		t.Errorf("expected ParseError for Hex, got %v", err)
+	}
+
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_UNKNOWN", "MFRGG===") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestQueryStringMaps(t *testing.T) {
+	var s struct {
+		Options map[string]string   `format:"querystring"`
+		Filters map[string][]string `format:"querystring"`
+		Params  url.Values          `format:"querystring"`
+		Limits  map[string]int      `format:"querystring"`
+		Labels  map[string]string
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_OPTIONS": "a=1&b=two+words&c=x%3Dy",
+		"ENV_CONFIG_FILTERS": "tag=a&tag=b&owner=me",
+		"ENV_CONFIG_PARAMS":  "q=go",
+		"ENV_CONFIG_LIMITS":  "cpu=2&memory=512",
+		"ENV_CONFIG_LABELS":  "a:1,b:2",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := map[string]string{"a": "1", "b": "two words", "c": "x=y"}; !reflect.DeepEqual(s.Options, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Options)
+	}
+	if expected := map[string][]string{"tag": {"a", "b"}, "owner": {"me"}}; !reflect.DeepEqual(s.Filters, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Filters)
+	}
+	if s.Params.Get("q") != "go" {
+		t.Errorf("expected %s, got %s", "go", s.Params.Get("q"))
+	}
+	if expected := map[string]int{"cpu": 2, "memory": 512}; !reflect.DeepEqual(s.Limits, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Limits)
+	}
+	if expected := map[string]string{"a": "1", "b": "2"}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Labels)
+	}
+
+	if os.Setenv("ENV_CONFIG_OPTIONS", "a=%zz") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.FieldName != "Options" {
+		t.Errorf("expected ParseError for Options, got %v", err)
+	}
+}
+
+// binaryKey only implements encoding.BinaryUnmarshaler
+type binaryKey struct {
+	ID     byte
+	Secret []byte
+}
+
+func (k *binaryKey) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return errors.New("empty key")
+	}
+	k.ID, k.Secret = data[0], data[1:]
+	return nil
+}
+
+func TestBinaryUnmarshaler(t *testing.T) {
+	var s struct {
+		Key    binaryKey
+		Backup *binaryKey
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_KEY", "AWhlbGxv") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_BACKUP", "Ag==") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Key.ID != 1 || string(s.Key.Secret) != "hello" {
+		t.Errorf("expected %v, got %v", binaryKey{1, []byte("hello")}, s.Key)
+	}
+	if s.Backup == nil || s.Backup.ID != 2 {
+		t.Errorf("expected %v, got %v", binaryKey{ID: 2}, s.Backup)
+	}
+
+	if os.Setenv("ENV_CONFIG_KEY", "") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+	if os.Setenv("ENV_CONFIG_KEY", "not base64!") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestComplexFields(t *testing.T) {
+	var s struct {
+		Pole  complex128
+		Zero  complex64 `default:"1-2i"`
+		Gains []complex128
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_POLE", "3+4i") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_GAINS", "1i,2.5") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Pole != 3+4i {
+		t.Errorf("expected %v, got %v", 3+4i, s.Pole)
+	}
+	if s.Zero != 1-2i {
+		t.Errorf("expected %v, got %v", 1-2i, s.Zero)
+	}
+	if expected := []complex128{1i, 2.5}; !reflect.DeepEqual(s.Gains, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Gains)
+	}
+
+	if os.Setenv("ENV_CONFIG_POLE", "3+4j") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Port":          "Port",
+		"MaxConns":      "Max_Conns",
+		"APIKey":        "API_Key",
+		"ServiceURL":    "Service_URL",
+		"Retry2Delay":   "Retry_2_Delay",
+		"MultiWordVar1": "Multi_Word_Var_1",
+		"MySQLHost":     "MySQL_Host",
+		"ReadMySQL":     "Read_MySQL",
+		"OAuthToken":    "OAuth_Token",
+		"UseIPv6":       "Use_IPv6",
+		"Mysterious":    "Mysterious",
+	} {
+		if got := splitWords(name); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
+
+func TestSplitWordsTag(t *testing.T) {
+	var s struct {
+		MaxConns  int    `split_words:"true"`
+		MultiWord string `split_words:"true" envconfig:"words"`
+		OtherVar  string
+		Retry2    int `split_words:"true"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP_MAX_CONNS": "10",
+		"APP_WORDS":     "override",
+		"APP_OTHERVAR":  "other",
+		"APP_RETRY_2":   "3",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("app", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 10 {
+		t.Errorf("expected %d, got %d", 10, s.MaxConns)
+	}
+	if s.MultiWord != "override" {
+		t.Errorf("expected %s, got %s", "override", s.MultiWord)
+	}
+	if s.OtherVar != "other" {
+		t.Errorf("expected %s, got %s", "other", s.OtherVar)
+	}
+	if s.Retry2 != 3 {
+		t.Errorf("expected %d, got %d", 3, s.Retry2)
+	}
+}
+
+func TestArrayFields(t *testing.T) {
+	var s struct {
+		Color      [3]uint8
+		Thresholds [3]float64 `delimiter:";" default:"0.5;0.75;0.9"`
+		Timeouts   [2]time.Duration
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_COLOR", "255,128,0") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TIMEOUTS", "1s,1m") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := [3]uint8{255, 128, 0}; s.Color != expected {
+		t.Errorf("expected %v, got %v", expected, s.Color)
+	}
+	if expected := [3]float64{0.5, 0.75, 0.9}; s.Thresholds != expected {
+		t.Errorf("expected %v, got %v", expected, s.Thresholds)
+	}
+	if expected := [2]time.Duration{time.Second, time.Minute}; s.Timeouts != expected {
+		t.Errorf("expected %v, got %v", expected, s.Timeouts)
+	}
+
+	if os.Setenv("ENV_CONFIG_COLOR", "255,128") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.FieldName != "Color" {
+		t.Errorf("expected %s, got %s", "Color", v.FieldName)
+	}
+}
+
+func TestProcessConcurrently(t *testing.T) {
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "localhost", "Limits": {"cpu": 2}}`)
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TAGS", "a,b,c") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var s struct {
+				Host    string
+				Port    int
+				Timeout time.Duration `default:"5s"`
+				Tags    []string
+				Limits  map[string]int
+				Nested  *struct {
+					Name string `default:"nested"`
+				}
+			}
+			if err := Process("env_config", []string{path}, &s); err != nil {
+				t.Error(err.Error())
+				return
+			}
+			if s.Host != "localhost" || s.Port != 8080 || s.Timeout != 5*time.Second || len(s.Tags) != 3 || s.Limits["cpu"] != 2 || s.Nested.Name != "nested" {
+				t.Errorf("unexpected specification %+v", s)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestDefaultExpansion(t *testing.T) {
+	var s struct {
+		Cache   string `default:"${HOME}/.myapp/cache"`
+		User    string `default:"$USER"`
+		Price   string `default:"$$5"`
+		Missing string `default:"${UNDEFINED}/data"`
+	}
+	os.Clearenv()
+	if os.Setenv("HOME", "/home/kelsey") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("USER", "kelsey") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Cache != "/home/kelsey/.myapp/cache" {
+		t.Errorf("expected %s, got %s", "/home/kelsey/.myapp/cache", s.Cache)
+	}
+	if s.User != "kelsey" {
+		t.Errorf("expected %s, got %s", "kelsey", s.User)
+	}
+	if s.Price != "$5" {
+		t.Errorf("expected %s, got %s", "$5", s.Price)
+	}
+	if s.Missing != "/data" {
+		t.Errorf("expected %s, got %s", "/data", s.Missing)
+	}
+
+	err := ProcessWithOptions(&s, WithPrefix("env_config"), WithStrictDefaults())
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.FieldName != "Missing" {
+		t.Errorf("expected %s, got %s", "Missing", v.FieldName)
+	}
+}
+
+func TestPointerSlices(t *testing.T) {
+	var s struct {
+		Hosts   *[]string
+		Ports   []*int
+		Weights *[]*float64 `default:"0.5,1.5"`
+		Unset   *[]string
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_HOSTS", "a,b") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PORTS", "80,443") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Hosts == nil || !reflect.DeepEqual(*s.Hosts, []string{"a", "b"}) {
+		t.Errorf("expected %v, got %v", []string{"a", "b"}, s.Hosts)
+	}
+	if len(s.Ports) != 2 || s.Ports[0] == nil || *s.Ports[0] != 80 || s.Ports[1] == nil || *s.Ports[1] != 443 {
+		t.Errorf("expected %v, got %v", []int{80, 443}, s.Ports)
+	}
+	if s.Weights == nil || len(*s.Weights) != 2 || *(*s.Weights)[1] != 1.5 {
+		t.Errorf("expected %v, got %v", []float64{0.5, 1.5}, s.Weights)
+	}
+	if s.Unset != nil {
+		t.Errorf("expected <nil>, got %v", *s.Unset)
+	}
+}
+
+func TestSecretParseError(t *testing.T) {
+	var s struct {
+		Password int `secret:"true"`
+		Port     int
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PASSWORD", "hunter2") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.Value != "***" {
+		t.Errorf("expected %s, got %s", "***", v.Value)
+	}
+	if strings.Contains(v.Error(), "hunter2") {
+		t.Errorf("expected the secret to be redacted from %q", v.Error())
+	}
+	if !errors.Is(v.Err, strconv.ErrSyntax) || !v.IsSyntax() {
+		t.Errorf("expected %v, got %v", strconv.ErrSyntax, v.Err)
+	}
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		t.Errorf("expected the cause to be dropped, got %v", numErr)
+	}
+
+	// the secret must not leak through the elements of slices and maps, or
+	// when the value in the message is trimmed
+	var c struct {
+		Pins   []int          `secret:"true"`
+		Tokens map[string]int `secret:"true"`
+		PIN    int            `secret:"true"`
+	}
+	for key, value := range map[string]string{
+		"ENV_CONFIG_PINS":   "1,hunter2",
+		"ENV_CONFIG_TOKENS": "db:hunter2",
+		"ENV_CONFIG_PIN":    " hunter2\n",
+	} {
+		os.Clearenv()
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+		err := ProcessWithOptions(&c, WithPrefix("env_config"), WithTrimSpace())
+		if _, ok := err.(*ParseError); !ok {
+			t.Errorf("%s: expected ParseError, got %v", key, err)
+		} else if strings.Contains(err.Error(), "hunter2") {
+			t.Errorf("%s: expected the secret to be redacted from %q", key, err.Error())
+		}
+		if errors.As(err, &numErr) {
+			t.Errorf("%s: expected the cause to be dropped, got %v", key, numErr)
+		}
+	}
+
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "eighty") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.Value != "eighty" {
+		t.Errorf("expected the value of a regular field to be kept, got %v", err)
+	}
+}
+
+func TestDurationElements(t *testing.T) {
+	var s struct {
+		RetryDelays []time.Duration
+		Timeout     *time.Duration
+		Deadlines   map[string]*time.Duration
+		Backoff     *[]time.Duration `default:"100ms,1s"`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_RETRYDELAYS", "1s,2s,5s") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TIMEOUT", "1m30s") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_DEADLINES", "read:5s") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := []time.Duration{time.Second, 2 * time.Second, 5 * time.Second}; !reflect.DeepEqual(s.RetryDelays, expected) {
+		t.Errorf("expected %v, got %v", expected, s.RetryDelays)
+	}
+	if s.Timeout == nil || *s.Timeout != 90*time.Second {
+		t.Errorf("expected %s, got %v", 90*time.Second, s.Timeout)
+	}
+	if d := s.Deadlines["read"]; d == nil || *d != 5*time.Second {
+		t.Errorf("expected %s, got %v", 5*time.Second, d)
+	}
+	if expected := []time.Duration{100 * time.Millisecond, time.Second}; s.Backoff == nil || !reflect.DeepEqual(*s.Backoff, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Backoff)
+	}
+}
+
+func TestEmbeddedStructPointer(t *testing.T) {
+	var byValue struct {
+		Embedded
+		Name string
+	}
+	var byPointer struct {
+		*Embedded
+		Name string
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_ENABLED":               "true",
+		"ENV_CONFIG_EMBEDDEDPORT":          "1234",
+		"ENV_CONFIG_EMBEDDED_WITH_ALT":     "foobar",
+		"ENV_CONFIG_EMBEDDED_EMBEDDEDPORT": "4321",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+
+	valueReport, err := ProcessWithReport("env_config", nil, &byValue)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	pointerReport, err := ProcessWithReport("env_config", nil, &byPointer)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if byPointer.Embedded == nil {
+		t.Fatal("expected the embedded pointer to be allocated")
+	}
+	if !reflect.DeepEqual(*byPointer.Embedded, byValue.Embedded) {
+		t.Errorf("expected %+v, got %+v", byValue.Embedded, *byPointer.Embedded)
+	}
+	if byPointer.EmbeddedPort != 1234 || byPointer.EmbeddedAlt != "foobar" {
+		t.Errorf("expected %d and %s, got %d and %s", 1234, "foobar", byPointer.EmbeddedPort, byPointer.EmbeddedAlt)
+	}
+	if !reflect.DeepEqual(pointerReport, valueReport) {
+		t.Errorf("expected %v, got %v", valueReport, pointerReport)
+	}
+
+	var valueUsage, pointerUsage bytes.Buffer
+	if err := Usage("env_config", &byValue, &valueUsage); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := Usage("env_config", &byPointer, &pointerUsage); err != nil {
+		t.Fatal(err.Error())
+	}
+	if valueUsage.String() != pointerUsage.String() {
+		t.Errorf("expected %s, got %s", valueUsage.String(), pointerUsage.String())
+	}
+}
+
+func TestIntegerBase(t *testing.T) {
+	var s struct {
+		Color  uint32 `base:"16"`
+		Mode   int    `base:"8" default:"755"`
+		Offset int    `base:"16"`
+		Auto   int
+		Bad    int `base:"x"`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_COLOR", "ff8800") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_OFFSET", "-1f") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_AUTO", "0x10") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Color != 0xff8800 {
+		t.Errorf("expected %v, got %v", 0xff8800, s.Color)
+	}
+	if s.Mode != 0755 {
+		t.Errorf("expected %v, got %v", 0755, s.Mode)
+	}
+	if s.Offset != -0x1f {
+		t.Errorf("expected %v, got %v", -0x1f, s.Offset)
+	}
+	if s.Auto != 16 {
+		t.Errorf("expected %v, got %v", 16, s.Auto)
+	}
+
+	if os.Setenv("ENV_CONFIG_COLOR", "0xff8800") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BAD", "1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	var s struct {
+		LogLevel string   `oneof:"debug info warn|warning error"`
+		Mode     *string  `oneof:"dev prod" ignore_case:"true"`
+		Ports    []int    `oneof:"80 443"`
+		Tags     []string `oneof:"a b"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_LOGLEVEL": "warning",
+		"ENV_CONFIG_MODE":     "PROD",
+		"ENV_CONFIG_PORTS":    "443,80",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.LogLevel != "warn" {
+		t.Errorf("expected %s, got %s", "warn", s.LogLevel)
+	}
+	if s.Mode == nil || *s.Mode != "prod" {
+		t.Errorf("expected %s, got %v", "prod", s.Mode)
+	}
+	if expected := []int{443, 80}; !reflect.DeepEqual(s.Ports, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Ports)
+	}
+
+	if os.Setenv("ENV_CONFIG_LOGLEVEL", "INFO") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := Process("env_config", nil, &s)
+	if v, ok := err.(*ParseError); !ok || v.KeyName != "ENV_CONFIG_LOGLEVEL" {
+		t.Errorf("expected ParseError for ENV_CONFIG_LOGLEVEL, got %v", err)
+	} else if expected := `"INFO" is not one of debug, info, warn, error`; v.Err.Error() != expected {
+		t.Errorf("expected %q, got %q", expected, v.Err.Error())
+	}
+
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_TAGS", "a,c") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+
+	// config files are checked as well
+	os.Clearenv()
+	s.LogLevel, s.Mode, s.Ports, s.Tags = "", nil, nil, nil
+	config := `{"LogLevel": "warning", "Mode": "Dev", "Ports": [80], "Tags": ["b"]}`
+	if err := ProcessWithOptions(&s, WithConfigReaders(strings.NewReader(config))); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.LogLevel != "warn" {
+		t.Errorf("expected %s, got %s", "warn", s.LogLevel)
+	}
+	if s.Mode == nil || *s.Mode != "dev" {
+		t.Errorf("expected %s, got %v", "dev", s.Mode)
+	}
+	for _, config := range []string{`{"LogLevel": "verbose"}`, `{"Ports": [8080]}`, `{"Tags": ["a", "c"]}`} {
+		err := ProcessWithOptions(&s, WithConfigReaders(strings.NewReader(config)))
+		if _, ok := err.(*ConfigFileError); !ok || !strings.Contains(err.Error(), "is not one of") {
+			t.Errorf("%s: expected ConfigFileError, got %v", config, err)
+		}
+	}
+}
+
+func TestUnsupportedKinds(t *testing.T) {
+	var s struct {
+		Name    string
+		Updates chan string `default:"x"`
+		OnLoad  func()
+		Cancel  *func()
+		Nested  struct {
+			Done chan struct{}
+		}
+	}
+	updates := make(chan string)
+	s.Updates = updates
+	os.Clearenv()
+	for _, key := range []string{"APP_NAME", "APP_UPDATES", "APP_ONLOAD", "APP_CANCEL", "APP_NESTED_DONE"} {
+		if os.Setenv(key, "x") != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithDisallowUnknownEnv()); err == nil {
+		t.Errorf("expected the variables of channel and function fields to be unknown")
+	}
+	if err := Process("app", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Name != "x" {
+		t.Errorf("expected %s, got %s", "x", s.Name)
+	}
+	if s.Updates != updates || s.OnLoad != nil || s.Cancel != nil || s.Nested.Done != nil {
+		t.Errorf("expected channel and function fields to be left alone")
+	}
+	if expected := []string{"APP_NAME"}; !reflect.DeepEqual(Keys("app", &s), expected) {
+		t.Errorf("expected %v, got %v", expected, Keys("app", &s))
+	}
+	b, err := Marshal(&s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := `{"Name":"x","Nested":{}}`; string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
 }
@@ -0,0 +1,75 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"os"
+)
+
+// A Lookuper provides the values of environment variables by name. The
+// environment layer reads from the process environment by default, and
+// WithLookuper replaces it with any other Lookuper.
+type Lookuper interface {
+	Lookup(key string) (string, bool)
+}
+
+// OsLookuper returns a Lookuper that reads the environment of the process.
+func OsLookuper() Lookuper {
+	return osLookuper{}
+}
+
+type osLookuper struct{}
+
+func (osLookuper) Lookup(key string) (string, bool) {
+	// `os.Getenv` cannot differentiate between an explicitly set empty value
+	// and an unset value. `os.LookupEnv` is preferred to `syscall.Getenv`,
+	// but it is only available in go1.5 or newer.
+	return os.LookupEnv(key)
+}
+
+// MapLookuper returns a Lookuper that reads the values of m.
+func MapLookuper(m map[string]string) Lookuper {
+	return mapLookuper(m)
+}
+
+type mapLookuper map[string]string
+
+func (m mapLookuper) Lookup(key string) (string, bool) {
+	value, ok := m[key]
+	return value, ok
+}
+
+// PrefixLookuper returns a Lookuper that looks up keys in l with prefix
+// prepended, e.g. to read APP_PORT from a store that holds it as
+// PROD_APP_PORT.
+func PrefixLookuper(prefix string, l Lookuper) Lookuper {
+	return &prefixLookuper{prefix: prefix, l: l}
+}
+
+type prefixLookuper struct {
+	prefix string
+	l      Lookuper
+}
+
+func (p *prefixLookuper) Lookup(key string) (string, bool) {
+	return p.l.Lookup(p.prefix + key)
+}
+
+// MultiLookuper returns a Lookuper that tries each of ls in order and returns
+// the first value found.
+func MultiLookuper(ls ...Lookuper) Lookuper {
+	return multiLookuper(ls)
+}
+
+type multiLookuper []Lookuper
+
+func (m multiLookuper) Lookup(key string) (string, bool) {
+	for _, l := range m {
+		if value, ok := l.Lookup(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
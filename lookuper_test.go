@@ -0,0 +1,72 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLookupers(t *testing.T) {
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_HOST", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	l := MultiLookuper(
+		MapLookuper(map[string]string{"ENV_CONFIG_PORT": "8080"}),
+		OsLookuper(),
+		PrefixLookuper("PROD_", MapLookuper(map[string]string{"PROD_ENV_CONFIG_USER": "prod"})),
+	)
+
+	for key, expected := range map[string]string{
+		"ENV_CONFIG_HOST": "env",
+		"ENV_CONFIG_PORT": "8080",
+		"ENV_CONFIG_USER": "prod",
+	} {
+		if value, ok := l.Lookup(key); !ok || value != expected {
+			t.Errorf("expected %s for %s, got %s", expected, key, value)
+		}
+	}
+	if _, ok := l.Lookup("ENV_CONFIG_MISSING"); ok {
+		t.Errorf("expected ENV_CONFIG_MISSING to be missing")
+	}
+}
+
+func TestWithLookuper(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+		User string `default:"${ENV_CONFIG_HOST}"`
+	}
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, ".env", "ENV_CONFIG_PORT=9000\n")
+
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_HOST", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err = ProcessWithOptions(&s,
+		WithPrefix("env_config"),
+		WithLookuper(MapLookuper(map[string]string{"ENV_CONFIG_HOST": "lookuper"})),
+		WithDotEnv(path),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "lookuper" {
+		t.Errorf("expected %s, got %s", "lookuper", s.Host)
+	}
+	if s.Port != 9000 {
+		t.Errorf("expected %d, got %d", 9000, s.Port)
+	}
+	if s.User != "lookuper" {
+		t.Errorf("expected %s, got %s", "lookuper", s.User)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// redacted replaces the values of fields tagged with `secret:"true"`
+const redacted = `"***"`
+
+// Marshal returns the json encoding of spec, such as the effective config
+// after Process, for logging it. Fields are encoded like json.Marshal does,
+// except that the values of fields tagged with `secret:"true"` are replaced
+// with "***", including in nested structs, slices and maps, and channel and
+// function fields are left out. spec is not modified.
+func Marshal(spec interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := marshalValue(&buf, reflect.ValueOf(spec)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func marshalValue(buf *bytes.Buffer, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			buf.WriteString("null")
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		buf.WriteString("null")
+		return nil
+	}
+	if m, ok := jsonMarshaler(v); ok {
+		return marshalWith(buf, m)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return marshalStruct(buf, v)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && (v.IsNil() || v.Type().Elem().Kind() == reflect.Uint8) {
+			return marshalWith(buf, v.Interface())
+		}
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := marshalValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case reflect.Map:
+		return marshalMap(buf, v)
+	}
+	return marshalWith(buf, v.Interface())
+}
+
+// jsonMarshaler returns the value that encodes v through its own MarshalJSON
+// or MarshalText method, if it has one.
+func jsonMarshaler(v reflect.Value) (interface{}, bool) {
+	candidates := []reflect.Value{v}
+	if v.CanAddr() {
+		candidates = append(candidates, v.Addr())
+	}
+	for _, c := range candidates {
+		if !c.CanInterface() {
+			continue
+		}
+		switch c.Interface().(type) {
+		case json.Marshaler, encoding.TextMarshaler:
+			return c.Interface(), true
+		}
+	}
+	return nil, false
+}
+
+func marshalWith(buf *bytes.Buffer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(b)
+	return nil
+}
+
+// jsonField is a struct field as encoding/json sees it
+type jsonField struct {
+	name   string
+	value  reflect.Value
+	secret bool
+}
+
+func marshalStruct(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteByte('{')
+	for i, f := range jsonFields(v, nil) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := marshalWith(buf, f.name); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if f.secret {
+			buf.WriteString(redacted)
+			continue
+		}
+		if err := marshalValue(buf, f.value); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// jsonFields appends the fields of the struct v that encoding/json would
+// encode to fields, following its json tag rules and promoting the fields of
+// embedded structs.
+func jsonFields(v reflect.Value, fields []jsonField) []jsonField {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		tag := strings.Split(ftype.Tag.Get("json"), ",")
+		if tag[0] == "-" && len(tag) == 1 {
+			continue
+		}
+
+		f := v.Field(i)
+		if ftype.Anonymous && tag[0] == "" {
+			for f.Kind() == reflect.Ptr && !f.IsNil() {
+				f = f.Elem()
+			}
+			if f.Kind() == reflect.Struct {
+				fields = jsonFields(f, fields)
+				continue
+			}
+		}
+		// unlike encoding/json, channels and functions are left out rather
+		// than failing the whole encoding
+		if ftype.PkgPath != "" || isUnsupported(ftype.Type) {
+			continue
+		}
+
+		name := ftype.Name
+		if tag[0] != "" {
+			name = tag[0]
+		}
+		omitEmpty := false
+		for _, opt := range tag[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if omitEmpty && isEmptyJsonValue(f) {
+			continue
+		}
+		fields = append(fields, jsonField{name: name, value: f, secret: ftype.Tag.Get("secret") == "true"})
+	}
+	return fields
+}
+
+// isEmptyJsonValue reports whether v is left out by the omitempty option
+func isEmptyJsonValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.IsZero()
+	}
+	return false
+}
+
+func marshalMap(buf *bytes.Buffer, v reflect.Value) error {
+	if v.IsNil() {
+		buf.WriteString("null")
+		return nil
+	}
+
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	for _, k := range v.MapKeys() {
+		var key string
+		if m, ok := k.Interface().(encoding.TextMarshaler); ok && k.Kind() != reflect.String {
+			text, err := m.MarshalText()
+			if err != nil {
+				return err
+			}
+			key = string(text)
+		} else {
+			switch k.Kind() {
+			case reflect.String:
+				key = k.String()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				key = fmt.Sprint(k.Interface())
+			default:
+				return fmt.Errorf("kkonfig: unsupported map key type %s", k.Type())
+			}
+		}
+		keys = append(keys, key)
+		values[key] = v.MapIndex(k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := marshalWith(buf, key); err != nil {
+			return err
+		}
+		buf.WriteByte(':')
+		if err := marshalValue(buf, values[key]); err != nil {
+			return err
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type marshalCredentials struct {
+	User     string
+	Password string `secret:"true"`
+}
+
+type marshalSpecification struct {
+	marshalCredentials
+	Host      string        `json:"host"`
+	Port      int           `json:"port,omitempty"`
+	Timeout   time.Duration `json:"timeout"`
+	Started   time.Time
+	APIKey    *string `secret:"true"`
+	Replicas  []marshalCredentials
+	Upstreams map[string]*marshalCredentials
+	Internal  string `json:"-"`
+	Tags      []string
+	private   string
+}
+
+func TestMarshal(t *testing.T) {
+	key := "key"
+	s := marshalSpecification{
+		marshalCredentials: marshalCredentials{User: "admin", Password: "hunter2"},
+		Host:               "localhost",
+		Timeout:            time.Second,
+		Started:            time.Date(2016, 8, 16, 18, 57, 5, 0, time.UTC),
+		APIKey:             &key,
+		Replicas:           []marshalCredentials{{User: "replica", Password: "secret"}},
+		Upstreams:          map[string]*marshalCredentials{"b": {User: "b"}, "a": nil},
+		Internal:           "internal",
+		private:            "private",
+	}
+
+	b, err := Marshal(&s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := `{"User":"admin","Password":"***","host":"localhost","timeout":1000000000,` +
+		`"Started":"2016-08-16T18:57:05Z","APIKey":"***","Replicas":[{"User":"replica","Password":"***"}],` +
+		`"Upstreams":{"a":null,"b":{"User":"b","Password":"***"}},"Tags":null}`
+	if string(b) != expected {
+		t.Errorf("expected %s, got %s", expected, b)
+	}
+	if !json.Valid(b) {
+		t.Errorf("expected valid json, got %s", b)
+	}
+
+	if s.Password != "hunter2" || *s.APIKey != "key" || s.Replicas[0].Password != "secret" {
+		t.Errorf("expected the specification to be left untouched, got %+v", s)
+	}
+}
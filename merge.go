@@ -0,0 +1,78 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Merge overlays src onto dst, which must be pointers to structs of the same
+// type, such as a per-tenant config onto global defaults. Fields of src that
+// are set win: nested structs are merged field by field, pointers and
+// interfaces are set if they aren't nil, slices and maps replace those of dst
+// wholesale if they aren't nil, and other fields are set if they aren't zero.
+// A field of src can't reset one of dst to its zero value, such as a bool to
+// false, unless it is a pointer.
+func Merge(dst, src interface{}) error {
+	if err := checkSpec(dst); err != nil {
+		return err
+	}
+	if err := checkSpec(src); err != nil {
+		return err
+	}
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	if d.Type() != s.Type() {
+		return fmt.Errorf("kkonfig: cannot merge %s into %s", s.Type(), d.Type())
+	}
+	mergeStruct(d, s)
+	return nil
+}
+
+func mergeStruct(dst, src reflect.Value) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		if ftype.PkgPath != "" {
+			// the exported fields of an unexported embedded struct are
+			// still promoted
+			if ftype.Anonymous && ftype.Type.Kind() == reflect.Struct {
+				mergeStruct(dst.Field(i), src.Field(i))
+			}
+			continue
+		}
+		mergeValue(dst.Field(i), src.Field(i))
+	}
+}
+
+func mergeValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Struct:
+		// types like time.Time are values of their own rather than groups
+		// of settings
+		if isStandardType(src.Type()) || isNullable(src.Type()) || implementsParser(src.Type()) {
+			break
+		}
+		mergeStruct(dst, src)
+		return
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		// copy the value so that dst doesn't share it with src
+		p := reflect.New(src.Type().Elem())
+		p.Elem().Set(src.Elem())
+		dst.Set(p)
+		return
+	case reflect.Interface, reflect.Slice, reflect.Map:
+		if !src.IsNil() {
+			dst.Set(src)
+		}
+		return
+	}
+	if !src.IsZero() {
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mergeDatabase struct {
+	Host    string
+	Port    int
+	Timeout time.Duration
+}
+
+type mergeSpecification struct {
+	Name     string
+	Debug    bool
+	Verbose  *bool
+	Started  time.Time
+	Tags     []string
+	Labels   map[string]string
+	Database mergeDatabase
+	Cache    *mergeDatabase
+	mergeEmbedded
+}
+
+type mergeEmbedded struct {
+	Region string
+}
+
+func TestMerge(t *testing.T) {
+	verbose := false
+	started := time.Date(2016, 8, 16, 2, 0, 0, 0, time.UTC)
+	dst := mergeSpecification{
+		Name:     "global",
+		Debug:    true,
+		Tags:     []string{"a", "b"},
+		Labels:   map[string]string{"team": "core"},
+		Database: mergeDatabase{Host: "db", Port: 5432, Timeout: time.Second},
+		Cache:    &mergeDatabase{Host: "cache"},
+	}
+	dst.Region = "eu"
+	src := mergeSpecification{
+		Verbose:  &verbose,
+		Started:  started,
+		Tags:     []string{},
+		Database: mergeDatabase{Host: "tenant-db"},
+		Cache:    &mergeDatabase{Port: 6379},
+	}
+	src.Region = "us"
+	if err := Merge(&dst, &src); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := mergeSpecification{
+		Name:     "global",
+		Debug:    true,
+		Verbose:  &verbose,
+		Started:  started,
+		Tags:     []string{},
+		Labels:   map[string]string{"team": "core"},
+		Database: mergeDatabase{Host: "tenant-db", Port: 5432, Timeout: time.Second},
+		Cache:    &mergeDatabase{Port: 6379},
+	}
+	expected.Region = "us"
+	if !reflect.DeepEqual(dst, expected) {
+		t.Errorf("expected %+v, got %+v", expected, dst)
+	}
+	if dst.Cache == src.Cache {
+		t.Errorf("expected pointers to be copied")
+	}
+
+	var other struct{ Name string }
+	if err := Merge(&dst, &other); err == nil {
+		t.Errorf("expected an error for specifications of different types")
+	}
+	if err := Merge(dst, &src); !errors.Is(err, ErrInvalidSpecification) {
+		t.Errorf("expected %v, got %v", ErrInvalidSpecification, err)
+	}
+}
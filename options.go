@@ -0,0 +1,695 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// An Option configures a call to ProcessWithOptions.
+type Option func(*options)
+
+// DecodeFunc parses a raw config value into a value of the type it was
+// registered for. The returned value must be assignable to that type.
+type DecodeFunc func(value string) (interface{}, error)
+
+type options struct {
+	ctx      context.Context
+	prefix   string
+	configs  []configInput
+	readers  int
+	embedded []configInput
+	decoders map[reflect.Type]DecodeFunc
+	sources  []prioritizedSource
+	formats  map[string]UnmarshalFunc
+	dotenv   []string
+
+	// environ replaces the process environment when it is set
+	environ Lookuper
+	// fsys replaces the OS filesystem for config files when it is set
+	fsys fs.FS
+	// envConfigKey names the variable that selects the config file made from
+	// envConfigPattern
+	envConfigKey     string
+	envConfigPattern string
+	// flagSet holds the flags that are applied after every other layer, parsed
+	// from flagArgs
+	flagSet  *flag.FlagSet
+	flagArgs []string
+
+	// sourceOrder is the order the layers are applied in
+	sourceOrder []Source
+	// skipped holds the layers that aren't applied at all
+	skipped map[Source]bool
+
+	errorOnMissingFile    bool
+	requireConfigFiles    bool
+	disallowUnknownFields bool
+	disallowUnknownEnv    bool
+	dottedKeys            bool
+	caseSensitiveJson     bool
+	useNumber             bool
+	jsonRoot              string
+	requireJsonRoot       bool
+	blankTemplateRefs     bool
+	nullSentinel          string
+	strictDefaults        bool
+	defaultsForEmpty      bool
+	httpClient            *http.Client
+	tagName               string
+	keySeparator          string
+	splitWords            bool
+	redactSecrets         bool
+	keyTransformer        func(fieldName, prefix string) string
+	caseSensitiveKeys     bool
+	jsonTagNames          bool
+	aggregateErrors       bool
+	strictBools           bool
+	trimSpace             bool
+	nilEmptySlices        bool
+	indirection           bool
+	checkKeyCollisions    bool
+
+	onDeprecated func(old, new string)
+	onFieldSet   func(path string, origin Origin)
+	onFileLoaded func(name string)
+	report       *Report
+
+	// origins holds where the fields that were given a value during the
+	// current run got it from, by field path. A json file only counts if it
+	// explicitly contains the field.
+	origins map[string]Origin
+	// nilStructs is how walking the spec treats nil pointers to structs,
+	// which only processing allocates.
+	nilStructs nilStructMode
+	// errs holds the field errors of the current run when errors are
+	// aggregated.
+	errs []error
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ctx:          context.Background(),
+		nullSentinel: "null",
+		sourceOrder:  []Source{SourceDefault, SourceFile, SourceEnv},
+		tagName:      "envconfig",
+		keySeparator: "_",
+		origins:      make(map[string]Origin),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithContext sets the context that bounds the call. Processing stops with
+// ctx.Err() once it is done, and requests for config URLs are made with it.
+// Config files and readers are checked between reads, but a read that blocks
+// isn't interrupted. A nil ctx stands for context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		o.ctx = ctx
+	}
+}
+
+// WithPrefix sets the prefix that is prepended to every environment variable
+// name.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithFS reads config files, including their base files and the matches of
+// glob patterns, from fsys instead of the OS filesystem, as well as the files
+// named by `file` tags and by @FILE: values with WithIndirection. Paths are
+// then slash-separated and relative to the root of fsys, as with fs.ReadFile.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// configInput is a json document that is unmarshaled into the specification,
+// read from reader, fetched from the URL in name, or read from the file at
+// name.
+type configInput struct {
+	name   string
+	reader io.Reader
+	url    bool
+	// optional skips a URL that can't be fetched
+	optional bool
+}
+
+// WithConfigPaths adds json files that are unmarshaled into the specification
+// after the defaults have been applied. Files are loaded in the given order.
+// A path may be a glob pattern such as conf.d/*.json, whose matches are loaded
+// in sorted order.
+func WithConfigPaths(paths ...string) Option {
+	return func(o *options) {
+		for _, path := range paths {
+			o.configs = append(o.configs, configInput{name: path})
+		}
+	}
+}
+
+// WithConfigReaders adds json documents that are read from readers and
+// unmarshaled into the specification at the same point as config files. Config
+// files and readers are loaded in the order their options are given. Relative
+// base paths in the documents are resolved against the working directory.
+func WithConfigReaders(readers ...io.Reader) Option {
+	return func(o *options) {
+		for _, r := range readers {
+			o.readers++
+			name := fmt.Sprintf("reader %d", o.readers)
+			o.configs = append(o.configs, configInput{name: name, reader: r})
+		}
+	}
+}
+
+// WithConfigURL adds a json document that is fetched with a GET request and
+// unmarshaled into the specification at the same point as config files. A
+// failed request or a response other than 2xx is an error. Relative base paths
+// in the document are resolved against the working directory.
+func WithConfigURL(url string) Option {
+	return func(o *options) {
+		o.configs = append(o.configs, configInput{name: url, url: true})
+	}
+}
+
+// WithOptionalConfigURL is the same as WithConfigURL, but a document that
+// can't be fetched is skipped like a missing config file.
+func WithOptionalConfigURL(url string) Option {
+	return func(o *options) {
+		o.configs = append(o.configs, configInput{name: url, url: true, optional: true})
+	}
+}
+
+// WithHTTPClient sets the client used to fetch config URLs, which defaults to
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithErrorOnMissingFile makes a config file that doesn't exist an error. By
+// default such files are skipped.
+func WithErrorOnMissingFile() Option {
+	return func(o *options) {
+		o.errorOnMissingFile = true
+	}
+}
+
+// WithRequireConfigFiles makes every config path an error unless it can be
+// read: a file that doesn't exist, like with WithErrorOnMissingFile, but also
+// one that can't be opened, such as for lack of permission, and a glob pattern
+// that matches no files. The error names the path. This catches typos in
+// paths that would otherwise silently leave a config unapplied.
+func WithRequireConfigFiles() Option {
+	return func(o *options) {
+		o.errorOnMissingFile = true
+		o.requireConfigFiles = true
+	}
+}
+
+// WithEnvironmentFrom layers a config file for the environment the variable key
+// names, such as APP_ENV=production, on top of the other config files. The
+// variable is read from the environment or a dotenv file. The path of the file
+// is pattern with the name of the environment in place of %s, such as
+// /etc/myapp/config.%s.json. Nothing happens if key isn't set, and the file is
+// skipped if it doesn't exist, unless WithRequireConfigFiles is used.
+func WithEnvironmentFrom(key, pattern string) Option {
+	return func(o *options) {
+		o.envConfigKey = key
+		o.envConfigPattern = pattern
+	}
+}
+
+// WithDisallowUnknownFields makes a key in a config file that doesn't match any
+// field of the specification an error, so that typos don't go unnoticed.
+func WithDisallowUnknownFields() Option {
+	return func(o *options) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// WithDottedKeys makes dotted top-level keys of config files address nested
+// fields, so {"database.host": "x"} sets Database.Host as if it were given as
+// {"database": {"host": "x"}}. Dotted and nested keys can be mixed.
+func WithDottedKeys() Option {
+	return func(o *options) {
+		o.dottedKeys = true
+	}
+}
+
+// WithCaseSensitiveJSON matches the keys of config files to fields exactly,
+// rather than case-insensitively like encoding/json does, so {"host": "x"}
+// doesn't set a field Host. Keys that only differ in case are ignored like
+// unknown keys.
+func WithCaseSensitiveJSON() Option {
+	return func(o *options) {
+		o.caseSensitiveJson = true
+	}
+}
+
+// WithJSONRoot decodes only the object under root into the specification,
+// so that several services can share a config file with a top-level key each.
+// root may be a dotted path of keys, such as services.myservice, and a
+// document that has nothing under root is skipped. A base file named by a
+// document is still taken from its top level.
+func WithJSONRoot(root string) Option {
+	return func(o *options) {
+		o.jsonRoot = root
+		o.requireJsonRoot = false
+	}
+}
+
+// WithRequiredJSONRoot is the same as WithJSONRoot, but a config document that
+// has nothing under root is a *ConfigFileError.
+func WithRequiredJSONRoot(root string) Option {
+	return func(o *options) {
+		o.jsonRoot = root
+		o.requireJsonRoot = true
+	}
+}
+
+// WithUseNumber decodes the numbers of config files that end up in interface{}
+// fields, such as the values of a map[string]interface{}, as json.Number
+// rather than float64, so that integers beyond 2^53 keep their exact value.
+// Fields of numeric types are always decoded exactly.
+func WithUseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+// WithDisallowUnknownEnv makes a variable in the process environment that
+// starts with the prefix, but isn't read by any field, an error. It has no
+// effect without a prefix or with WithLookuper.
+func WithDisallowUnknownEnv() Option {
+	return func(o *options) {
+		o.disallowUnknownEnv = true
+	}
+}
+
+// WithConfigBytes adds a json document, such as one compiled into the binary
+// with go:embed, that is unmarshaled into the specification before any config
+// files or readers. Multiple documents are applied in the given order.
+func WithConfigBytes(data []byte) Option {
+	return func(o *options) {
+		name := fmt.Sprintf("bytes %d", len(o.embedded)+1)
+		o.embedded = append(o.embedded, configInput{name: name, reader: bytes.NewReader(data)})
+	}
+}
+
+// WithDotEnv adds a dotenv file of KEY=VALUE lines whose values are used for
+// environment variables that aren't set in the process environment. Later
+// files override earlier ones, and missing files are skipped like config
+// files.
+func WithDotEnv(path string) Option {
+	return func(o *options) {
+		o.dotenv = append(o.dotenv, path)
+	}
+}
+
+// WithLookuper replaces the process environment as the source of environment
+// values with l. Dotenv files still fill in the keys l doesn't have.
+func WithLookuper(l Lookuper) Option {
+	return func(o *options) {
+		o.environ = l
+	}
+}
+
+// WithDecoder registers fn as the parser for fields of type t, for types that
+// cannot implement Decoder, Setter or encoding.TextUnmarshaler themselves.
+// Registered decoders take precedence over those interfaces.
+//
+// For example, protobuf well-known types can be populated with:
+//
+//	kkonfig.WithDecoder(reflect.TypeOf(&durationpb.Duration{}), func(value string) (interface{}, error) {
+//		d, err := time.ParseDuration(value)
+//		return durationpb.New(d), err
+//	})
+//	kkonfig.WithDecoder(reflect.TypeOf(&timestamppb.Timestamp{}), func(value string) (interface{}, error) {
+//		t, err := time.Parse(time.RFC3339Nano, value)
+//		return timestamppb.New(t), err
+//	})
+func WithDecoder(t reflect.Type, fn DecodeFunc) Option {
+	return func(o *options) {
+		if o.decoders == nil {
+			o.decoders = make(map[reflect.Type]DecodeFunc)
+		}
+		o.decoders[t] = fn
+	}
+}
+
+// WithSourceOrder sets the order in which the default values, config files and
+// environment are applied, so that a later layer overrides an earlier one. The
+// order must name SourceDefault, SourceFile and SourceEnv exactly once, and
+// defaults to that order. Sources added with WithConfigSource stay next to the
+// layer their precedence refers to.
+//
+// For example, config files can be made authoritative over the environment
+// with:
+//
+//	kkonfig.WithSourceOrder(kkonfig.SourceDefault, kkonfig.SourceEnv, kkonfig.SourceFile)
+func WithSourceOrder(order ...Source) Option {
+	return func(o *options) {
+		o.sourceOrder = order
+	}
+}
+
+// WithFlagSet registers a flag on flags for every key of the specification and
+// parses args, or os.Args[1:] if args is nil, with it. The flags that are
+// given are applied after every other layer, so the command line overrides
+// the environment. Flag names are the keys in lower case, with words separated
+// by hyphens, so APP_DB_HOST is set with -app-db-host. flags may define flags
+// of its own, and is created with flag.ContinueOnError if it is nil.
+func WithFlagSet(flags *flag.FlagSet, args []string) Option {
+	return func(o *options) {
+		if flags == nil {
+			flags = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+		}
+		o.flagSet = flags
+		o.flagArgs = args
+	}
+}
+
+// WithoutDefaults skips applying the default values, such as to test the other
+// layers in isolation. Required fields aren't checked when a layer is skipped,
+// since the layer might have provided them.
+func WithoutDefaults() Option {
+	return skip(SourceDefault)
+}
+
+// WithoutJSON skips loading config files, readers and URLs, such as to inspect
+// the defaults and environment alone. Like WithoutDefaults, it turns off the
+// check for required fields.
+func WithoutJSON() Option {
+	return skip(SourceFile)
+}
+
+// WithoutEnv skips reading the environment and dotenv files, such as to
+// inspect the config files on their own. Like WithoutDefaults, it turns off
+// the check for required fields.
+func WithoutEnv() Option {
+	return skip(SourceEnv)
+}
+
+// skip returns an Option that skips the layer s, along with the sources added
+// with WithConfigSource that sit next to it.
+func skip(s Source) Option {
+	return func(o *options) {
+		if o.skipped == nil {
+			o.skipped = make(map[Source]bool)
+		}
+		o.skipped[s] = true
+	}
+}
+
+// WithConfigSource adds src as an additional layer of config values, which is
+// consulted at the given precedence. Values are looked up with the same keys
+// as environment variables.
+func WithConfigSource(src ConfigSource, p SourcePrecedence) Option {
+	return func(o *options) {
+		o.sources = append(o.sources, prioritizedSource{src, p})
+	}
+}
+
+// WithBlankTemplateRefs expands references to unset fields in templated
+// values to an empty string. By default such references are an error.
+func WithBlankTemplateRefs() Option {
+	return func(o *options) {
+		o.blankTemplateRefs = true
+	}
+}
+
+// WithNullSentinel sets the value that resets fields tagged with
+// `nullable:"true"` to their zero value, or to nil for pointers, so that a
+// value set by a lower precedence layer can be removed. It defaults to "null";
+// an empty sentinel makes empty values reset the field.
+func WithNullSentinel(sentinel string) Option {
+	return func(o *options) {
+		o.nullSentinel = sentinel
+	}
+}
+
+// WithTagName sets the struct tag that overrides the name a field is looked up
+// by, which defaults to "envconfig". Other tags such as `default`, `required`
+// and `ignored` keep their names.
+func WithTagName(name string) Option {
+	return func(o *options) {
+		o.tagName = name
+	}
+}
+
+// WithKeySeparator sets the separator between the prefix and a field's name,
+// and between the names of nested structs and their fields, which defaults
+// to "_". A separator such as "__" keeps nesting apart from underscores in
+// field names, e.g. APP__DB__MAX_CONNS.
+func WithKeySeparator(sep string) Option {
+	return func(o *options) {
+		o.keySeparator = sep
+	}
+}
+
+// WithSplitWords derives keys from CamelCase field names by separating their
+// words with underscores, so MaxConns is read from MAX_CONNS instead of
+// MAXCONNS. Names given with the name override tag are used as is.
+func WithSplitWords() Option {
+	return func(o *options) {
+		o.splitWords = true
+	}
+}
+
+// WithRedactSecrets makes DumpWithOptions write "***" for the values of fields
+// tagged with `secret:"true"`, for output that is logged rather than used.
+func WithRedactSecrets() Option {
+	return func(o *options) {
+		o.redactSecrets = true
+	}
+}
+
+// WithKeyTransformer replaces the way keys are built from a field's name and
+// the prefix of its struct. fieldName is the name of the field, or the name
+// given with the name override tag, after WithSplitWords and WithJSONTagNames
+// have been applied. prefix is the prefix passed to processing for top-level
+// fields, and the key returned for the enclosing struct for nested fields. The
+// returned key is used as is: it isn't uppercased, even with an empty prefix.
+// The COUNT key and the index segments of slices of structs are built with it
+// too, and WithDisallowUnknownEnv checks the variables that start with the key
+// of an empty name under the prefix.
+func WithKeyTransformer(transform func(fieldName, prefix string) string) Option {
+	return func(o *options) {
+		o.keyTransformer = transform
+	}
+}
+
+// WithJSONTagNames derives keys from the name in a field's json tag when it
+// has no name override tag, so a field tagged `json:"max_connections"` is read
+// from MAX_CONNECTIONS.
+func WithJSONTagNames() Option {
+	return func(o *options) {
+		o.jsonTagNames = true
+	}
+}
+
+// WithCaseSensitiveKeys stops keys from being upper-cased, so a field apiKey
+// is read from apiKey, or from prefix_apiKey with a prefix.
+func WithCaseSensitiveKeys() Option {
+	return func(o *options) {
+		o.caseSensitiveKeys = true
+	}
+}
+
+// WithStrictDefaults makes a default value that references an undefined
+// environment variable an error, instead of expanding it to an empty string.
+func WithStrictDefaults() Option {
+	return func(o *options) {
+		o.strictDefaults = true
+	}
+}
+
+// WithDefaultsForEmpty applies default values again after the config files,
+// to fields that are still at their zero value. This keeps a config file that
+// sets a field to null or an empty value from clearing its default.
+func WithDefaultsForEmpty() Option {
+	return func(o *options) {
+		o.defaultsForEmpty = true
+	}
+}
+
+// WithCheckKeyCollisions makes it an error for two fields to be read from the
+// same key, which can happen through embedded structs or name override tags
+// and would otherwise let one field silently shadow the other. Collisions are
+// reported as a *KeyCollisionError naming the fields.
+func WithCheckKeyCollisions() Option {
+	return func(o *options) {
+		o.checkKeyCollisions = true
+	}
+}
+
+// WithStrictBools only accepts the values strconv.ParseBool does for bool
+// fields, such as true and 0, rather than also accepting yes, no, on, off,
+// enabled and disabled.
+func WithStrictBools() Option {
+	return func(o *options) {
+		o.strictBools = true
+	}
+}
+
+// WithTrimSpace trims leading and trailing whitespace from every value before
+// it is converted, including the elements of slices and the keys and values of
+// maps, so that values copied with stray spaces or newlines still parse. This
+// also applies to string fields, and to the string values of config files.
+func WithTrimSpace() Option {
+	return func(o *options) {
+		o.trimSpace = true
+	}
+}
+
+// WithNilEmptySlices sets slice fields to nil when their value is empty, such
+// as TAGS=, rather than to an empty slice. Either way an empty value means no
+// elements.
+func WithNilEmptySlices() Option {
+	return func(o *options) {
+		o.nilEmptySlices = true
+	}
+}
+
+// WithIndirection lets environment values point elsewhere: @ENV:NAME stands for
+// the value of the variable NAME and @FILE:PATH for the contents of the file
+// at PATH, without a single trailing newline. Any other value starting with @
+// is a ParseError, and @@ stands for a literal @.
+func WithIndirection() Option {
+	return func(o *options) {
+		o.indirection = true
+	}
+}
+
+// WithOnDeprecated sets a callback that is called whenever a field is read from
+// one of the old keys listed in its `deprecated` tag, with that key and the
+// field's current key, so that lingering old keys can be logged.
+func WithOnDeprecated(fn func(old, new string)) Option {
+	return func(o *options) {
+		o.onDeprecated = fn
+	}
+}
+
+// WithOnFieldSet sets a callback that is called whenever a layer gives a field
+// a value, with the field's path, such as Database.Host, and where the value
+// came from, so that the way a config was resolved can be logged. It is called
+// in processing order, which is the same for every run over the same input.
+func WithOnFieldSet(fn func(path string, origin Origin)) Option {
+	return func(o *options) {
+		o.onFieldSet = fn
+	}
+}
+
+// WithReport stores the Report of a successful run in r, the same one
+// ProcessWithReport returns, so that callers of ProcessWithOptions can tell
+// which fields were set.
+func WithReport(r *Report) Option {
+	return func(o *options) {
+		o.report = r
+	}
+}
+
+// WithOnFileLoaded sets a callback that is called with the name of every
+// config document once it has been loaded, including base files, readers and
+// URLs. It is called before WithOnFieldSet reports the fields the document
+// set.
+func WithOnFileLoaded(fn func(name string)) Option {
+	return func(o *options) {
+		o.onFileLoaded = fn
+	}
+}
+
+// WithErrorAggregation keeps processing the remaining fields when a field
+// fails to parse or a required field is missing, and returns every such error
+// at the end as an *AggregateError.
+func WithErrorAggregation() Option {
+	return func(o *options) {
+		o.aggregateErrors = true
+	}
+}
+
+// fail records err and returns nil when errors are aggregated, so that the
+// caller moves on to the next field. Otherwise it returns err unchanged.
+func (o *options) fail(err error) error {
+	if !o.aggregateErrors {
+		return err
+	}
+	o.errs = append(o.errs, err)
+	return nil
+}
+
+// setOrigin records where the field at path got its value from, and reports it
+// to the WithOnFieldSet callback.
+func (o *options) setOrigin(path string, origin Origin) {
+	o.origins[path] = origin
+	if o.onFieldSet != nil {
+		o.onFieldSet(path, origin)
+	}
+}
+
+// env returns the Lookuper environment values are read from, which is the
+// process environment unless it was replaced, backed by the values of the
+// dotenv files.
+func (o *options) env(dotenv map[string]string) Lookuper {
+	l := o.environ
+	if l == nil {
+		l = OsLookuper()
+	}
+	if len(dotenv) > 0 {
+		l = MultiLookuper(l, MapLookuper(dotenv))
+	}
+	return l
+}
+
+// environmentConfig returns the path of the config file selected with
+// WithEnvironmentFrom, or an empty path if there is none. The environment name
+// can also come from a dotenv file.
+func (o *options) environmentConfig() (string, error) {
+	if o.envConfigKey == "" {
+		return "", nil
+	}
+	if !strings.Contains(o.envConfigPattern, "%s") {
+		return "", fmt.Errorf("kkonfig: environment config pattern %q has no %%s", o.envConfigPattern)
+	}
+	dotenv, err := loadDotEnv(o)
+	if err != nil {
+		return "", err
+	}
+	name, ok := o.env(dotenv).Lookup(o.envConfigKey)
+	if !ok || name == "" {
+		return "", nil
+	}
+	// the name must not lead out of the directory of the pattern
+	if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("kkonfig: invalid environment name %q in %s", name, o.envConfigKey)
+	}
+	return strings.Replace(o.envConfigPattern, "%s", name, -1), nil
+}
+
+// hasDecoder reports whether a field of type t is parsed by a registered
+// decoder rather than being walked into.
+func (o *options) hasDecoder(t reflect.Type) bool {
+	_, ok := o.decoders[t]
+	return ok
+}
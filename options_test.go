@@ -0,0 +1,1216 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wellKnownDuration mirrors the layout of google.protobuf.Duration.
+type wellKnownDuration struct {
+	Seconds int64
+	Nanos   int32
+}
+
+// wellKnownTimestamp mirrors the layout of google.protobuf.Timestamp.
+type wellKnownTimestamp struct {
+	Seconds int64
+	Nanos   int32
+}
+
+func wellKnownDecoders() []Option {
+	return []Option{
+		WithDecoder(reflect.TypeOf(&wellKnownDuration{}), func(value string) (interface{}, error) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, err
+			}
+			return &wellKnownDuration{Seconds: int64(d / time.Second), Nanos: int32(d % time.Second)}, nil
+		}),
+		WithDecoder(reflect.TypeOf(&wellKnownTimestamp{}), func(value string) (interface{}, error) {
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return nil, err
+			}
+			return &wellKnownTimestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}, nil
+		}),
+	}
+}
+
+func TestWithDecoder(t *testing.T) {
+	var s struct {
+		Timeout   *wellKnownDuration `default:"1.5s"`
+		CreatedAt *wellKnownTimestamp
+		Unset     *wellKnownTimestamp
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_CREATEDAT", "2016-08-16T18:57:05Z") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	opts := append(wellKnownDecoders(), WithPrefix("env_config"))
+	if err := ProcessWithOptions(&s, opts...); err != nil {
+		t.Error(err.Error())
+	}
+
+	if s.Timeout == nil || s.Timeout.Seconds != 1 || s.Timeout.Nanos != 5e8 {
+		t.Errorf("expected %v, got %v", wellKnownDuration{1, 5e8}, s.Timeout)
+	}
+	if s.CreatedAt == nil || s.CreatedAt.Seconds != 1471373825 {
+		t.Errorf("expected %v, got %v", wellKnownTimestamp{Seconds: 1471373825}, s.CreatedAt)
+	}
+	if s.Unset != nil {
+		t.Errorf("expected <nil>, got %v", s.Unset)
+	}
+}
+
+func TestWithDecoderError(t *testing.T) {
+	var s struct {
+		Timeout *wellKnownDuration
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_TIMEOUT", "soon") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	opts := append(wellKnownDecoders(), WithPrefix("env_config"))
+	err := ProcessWithOptions(&s, opts...)
+	v, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected ParseError, got %v", err)
+	}
+	if v.FieldName != "Timeout" {
+		t.Errorf("expected %s, got %v", "Timeout", v.FieldName)
+	}
+}
+
+func TestWithDecoderNotAssignable(t *testing.T) {
+	var s struct {
+		Timeout *wellKnownDuration
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_TIMEOUT", "1s") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	err := ProcessWithOptions(&s,
+		WithPrefix("env_config"),
+		WithDecoder(reflect.TypeOf(&wellKnownDuration{}), func(value string) (interface{}, error) {
+			return time.ParseDuration(value)
+		}),
+	)
+	if _, ok := err.(*ParseError); !ok {
+		t.Errorf("expected ParseError, got %v", err)
+	}
+}
+
+func TestNullSentinel(t *testing.T) {
+	var s struct {
+		Host    string  `default:"localhost" nullable:"true"`
+		Port    *int    `default:"8080" nullable:"true"`
+		Name    string  `default:"app"`
+		Comment *string `nullable:"true"`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_HOST", "null") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PORT", "null") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_NAME", "null") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_COMMENT", "") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "" {
+		t.Errorf("expected %q, got %q", "", s.Host)
+	}
+	if s.Port != nil {
+		t.Errorf("expected <nil>, got %d", *s.Port)
+	}
+	if s.Name != "null" {
+		t.Errorf("expected %q, got %q", "null", s.Name)
+	}
+	if s.Comment == nil || *s.Comment != "" {
+		t.Errorf("expected an empty string, got %v", s.Comment)
+	}
+
+	s.Comment = nil
+	if os.Setenv("ENV_CONFIG_HOST", "-") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Unsetenv("ENV_CONFIG_PORT") != nil {
+		t.Errorf("Unable to use os.Unsetenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithNullSentinel("")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "-" {
+		t.Errorf("expected %q, got %q", "-", s.Host)
+	}
+	if s.Comment != nil {
+		t.Errorf("expected <nil>, got %q", *s.Comment)
+	}
+}
+
+func TestProcessWithOptions(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "localhost", "Port": 80}`)
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithConfigPaths(path)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+}
+
+type mustSpecification struct {
+	Port int `required:"true"`
+}
+
+func TestMustProcessWithOptions(t *testing.T) {
+	var s mustSpecification
+	os.Clearenv()
+	if os.Setenv("APP_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	MustProcessWithOptions(&s, WithPrefix("app"))
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	os.Clearenv()
+	defer func() {
+		err, ok := recover().(error)
+		if !ok {
+			t.Fatal("expected panic with an error")
+		}
+		var required *RequiredError
+		if !errors.As(err, &required) {
+			t.Errorf("expected the panic to wrap a RequiredError, got %v", err)
+		}
+		if prefix := "kkonfig: failed to process *kkonfig.mustSpecification (prefix APP): "; !strings.HasPrefix(err.Error(), prefix) {
+			t.Errorf("expected %q to start with %q", err.Error(), prefix)
+		}
+	}()
+	MustProcessWithOptions(&s, WithPrefix("app"))
+}
+
+func TestWithErrorOnMissingFile(t *testing.T) {
+	var s struct {
+		Host string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	missing := dir + "/missing.json"
+	if err := ProcessWithOptions(&s, WithConfigPaths(missing)); err != nil {
+		t.Errorf("expected a missing file to be skipped, got %s", err)
+	}
+
+	err = ProcessWithOptions(&s, WithConfigPaths(missing), WithErrorOnMissingFile())
+	v, ok := err.(*ConfigFileError)
+	if !ok {
+		t.Fatalf("expected ConfigFileError, got %v", err)
+	}
+	if v.Path != missing {
+		t.Errorf("expected %s, got %s", missing, v.Path)
+	}
+	if !os.IsNotExist(v.Err) {
+		t.Errorf("expected a not exist error, got %v", v.Err)
+	}
+}
+
+// lockedFS fails to open every file for lack of permission
+type lockedFS struct{}
+
+func (lockedFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+}
+
+func TestWithRequireConfigFiles(t *testing.T) {
+	var s struct {
+		Host string
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	existing := writeConfigFile(t, dir, "config.json", `{"Host": "localhost"}`)
+
+	if err := ProcessWithOptions(&s, WithConfigPaths(existing), WithRequireConfigFiles()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+
+	missing := dir + "/confg.json"
+	err = ProcessWithOptions(&s, WithConfigPaths(existing, missing), WithRequireConfigFiles())
+	if v, ok := err.(*ConfigFileError); !ok || v.Path != missing || !os.IsNotExist(v.Err) {
+		t.Errorf("expected ConfigFileError for %s, got %v", missing, err)
+	}
+
+	// permission errors are skipped unless config files are required
+	if err := ProcessWithOptions(&s, WithFS(lockedFS{}), WithConfigPaths("config.json"), WithErrorOnMissingFile()); err != nil {
+		t.Errorf("expected an unreadable file to be skipped, got %v", err)
+	}
+	err = ProcessWithOptions(&s, WithFS(lockedFS{}), WithConfigPaths("config.json"), WithRequireConfigFiles())
+	if v, ok := err.(*ConfigFileError); !ok || !errors.Is(v.Err, fs.ErrPermission) {
+		t.Errorf("expected ConfigFileError for lack of permission, got %v", err)
+	}
+
+	pattern := dir + "/conf.d/*.json"
+	if err := ProcessWithOptions(&s, WithConfigPaths(pattern)); err != nil {
+		t.Errorf("expected a pattern without matches to be skipped, got %v", err)
+	}
+	err = ProcessWithOptions(&s, WithConfigPaths(pattern), WithRequireConfigFiles())
+	if v, ok := err.(*ConfigFileError); !ok || v.Path != pattern {
+		t.Errorf("expected ConfigFileError for %s, got %v", pattern, err)
+	}
+}
+
+func TestWithEnvironmentFrom(t *testing.T) {
+	var s struct {
+		Host string
+		Port int
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := writeConfigFile(t, dir, "config.json", `{"Host": "localhost", "Port": 8080}`)
+	writeConfigFile(t, dir, "config.production.json", `{"Host": "example.com"}`)
+	pattern := dir + "/config.%s.json"
+
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+
+	if os.Setenv("APP_ENV", "production") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "example.com" {
+		t.Errorf("expected %s, got %s", "example.com", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	if os.Setenv("APP_ENV", "staging") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern)); err != nil {
+		t.Errorf("expected a missing environment file to be skipped, got %v", err)
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	err = ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern), WithRequireConfigFiles())
+	if v, ok := err.(*ConfigFileError); !ok || v.Path != dir+"/config.staging.json" {
+		t.Errorf("expected ConfigFileError for the staging config, got %v", err)
+	}
+
+	if os.Setenv("APP_ENV", "../production") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern)); err == nil {
+		t.Errorf("expected an error for an environment name with a path separator")
+	}
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", dir+"/config.json")); err == nil {
+		t.Errorf("expected an error for a pattern without %%s")
+	}
+
+	// the environment name can come from a dotenv file
+	os.Clearenv()
+	dotenv := writeConfigFile(t, dir, ".env", "APP_ENV=production\n")
+	if err := ProcessWithOptions(&s, WithConfigPaths(base), WithDotEnv(dotenv), WithEnvironmentFrom("APP_ENV", pattern)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "example.com" {
+		t.Errorf("expected %s, got %s", "example.com", s.Host)
+	}
+
+	// the variable naming the environment isn't an unknown one
+	if os.Setenv("APP_ENV", "production") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithConfigPaths(base), WithEnvironmentFrom("APP_ENV", pattern), WithDisallowUnknownEnv()); err != nil {
+		t.Errorf("expected APP_ENV to be known, got %v", err)
+	}
+}
+
+func TestWithErrorAggregation(t *testing.T) {
+	var s struct {
+		Port    int `default:"eighty"`
+		Debug   bool
+		Timeout time.Duration `required:"true"`
+		Host    string        `required:"true"`
+		User    string        `required:"true"`
+		Name    string
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_DEBUG", "maybe") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TIMEOUT", "soon") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_USER", "admin") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_NAME", "app") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	err := ProcessWithOptions(&s, WithPrefix("env_config"), WithErrorAggregation())
+	v, ok := err.(*AggregateError)
+	if !ok {
+		t.Fatalf("expected AggregateError, got %v", err)
+	}
+	if len(v.Errors) != 4 {
+		t.Fatalf("expected %d errors, got %d: %v", 4, len(v.Errors), v)
+	}
+	for i, field := range []string{"Port", "Debug", "Timeout"} {
+		if pe, ok := v.Errors[i].(*ParseError); !ok || pe.FieldName != field {
+			t.Errorf("expected a ParseError for %s, got %v", field, v.Errors[i])
+		}
+	}
+	if re, ok := v.Errors[3].(*RequiredError); !ok || re.KeyName != "ENV_CONFIG_HOST" {
+		t.Errorf("expected a RequiredError for %s, got %v", "ENV_CONFIG_HOST", v.Errors[3])
+	}
+	for _, key := range []string{"ENV_CONFIG_DEBUG", "ENV_CONFIG_TIMEOUT", "ENV_CONFIG_HOST"} {
+		if !strings.Contains(v.Error(), key) {
+			t.Errorf("expected %q to mention %s", v.Error(), key)
+		}
+	}
+	if s.Name != "app" {
+		t.Errorf("expected %s, got %s", "app", s.Name)
+	}
+
+	if _, ok := ProcessWithOptions(&s, WithPrefix("env_config")).(*ParseError); !ok {
+		t.Errorf("expected the first ParseError without aggregation")
+	}
+}
+
+func TestWithTagName(t *testing.T) {
+	var s struct {
+		Host string `kkonfig:"server_host" envconfig:"legacy_host"`
+		Port int    `envconfig:"server_port"`
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_SERVER_HOST", "localhost") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_LEGACY_HOST", "legacy") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithTagName("kkonfig")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "legacy" {
+		t.Errorf("expected %s, got %s", "legacy", s.Host)
+	}
+}
+
+func TestWithSplitWords(t *testing.T) {
+	var s struct {
+		MaxConns     int
+		APIKey       string
+		MySQLHost    string
+		Port         int
+		OverriddenID string `envconfig:"overridden"`
+		Database     struct {
+			ReadTimeout time.Duration
+		}
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"ENV_CONFIG_MAX_CONNS":             "10",
+		"ENV_CONFIG_API_KEY":               "secret",
+		"ENV_CONFIG_MYSQL_HOST":            "db",
+		"ENV_CONFIG_PORT":                  "8080",
+		"ENV_CONFIG_OVERRIDDEN":            "id",
+		"ENV_CONFIG_DATABASE_READ_TIMEOUT": "5s",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithSplitWords()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 10 {
+		t.Errorf("expected %d, got %d", 10, s.MaxConns)
+	}
+	if s.APIKey != "secret" {
+		t.Errorf("expected %s, got %s", "secret", s.APIKey)
+	}
+	if s.MySQLHost != "db" {
+		t.Errorf("expected %s, got %s", "db", s.MySQLHost)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.OverriddenID != "id" {
+		t.Errorf("expected %s, got %s", "id", s.OverriddenID)
+	}
+	if s.Database.ReadTimeout != 5*time.Second {
+		t.Errorf("expected %s, got %s", 5*time.Second, s.Database.ReadTimeout)
+	}
+}
+
+func TestWithKeyTransformer(t *testing.T) {
+	var s struct {
+		MaxConns     int
+		OverriddenID string `envconfig:"overridden"`
+		Database     struct {
+			Host string
+		}
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"app.max-conns":     "10",
+		"app.overridden":    "id",
+		"app.database.host": "db",
+		"APP_MAXCONNS":      "20",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	dotted := func(fieldName, prefix string) string {
+		return strings.ToLower(prefix + "." + strings.Replace(fieldName, "_", "-", -1))
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithSplitWords(), WithKeyTransformer(dotted)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 10 {
+		t.Errorf("expected %d, got %d", 10, s.MaxConns)
+	}
+	if s.OverriddenID != "id" {
+		t.Errorf("expected %s, got %s", "id", s.OverriddenID)
+	}
+	if s.Database.Host != "db" {
+		t.Errorf("expected %s, got %s", "db", s.Database.Host)
+	}
+
+	// without a transformer the default keys are used
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 20 {
+		t.Errorf("expected %d, got %d", 20, s.MaxConns)
+	}
+
+	// the keys of slices of structs and the check for unknown variables
+	// follow the transformer too
+	var c struct {
+		Servers []struct {
+			Port int
+		}
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"app.servers.count":  "2",
+		"app.servers.1.port": "8080",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&c, WithPrefix("app"), WithKeyTransformer(dotted), WithDisallowUnknownEnv()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(c.Servers) != 2 || c.Servers[1].Port != 8080 {
+		t.Errorf("expected 2 servers with port %d, got %v", 8080, c.Servers)
+	}
+	if os.Setenv("app.severs.count", "1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := ProcessWithOptions(&c, WithPrefix("app"), WithKeyTransformer(dotted), WithDisallowUnknownEnv())
+	if expected := "kkonfig: unknown environment variables: app.severs.count"; err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
+
+func TestWithCaseSensitiveKeys(t *testing.T) {
+	var s struct {
+		APIKey string `envconfig:"apiKey"`
+		Host   string
+	}
+	os.Clearenv()
+	if os.Setenv("app_apiKey", "secret") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("APP_APIKEY", "wrong") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("app_Host", "localhost") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithCaseSensitiveKeys()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.APIKey != "secret" {
+		t.Errorf("expected %s, got %s", "secret", s.APIKey)
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+}
+
+func TestWithJSONTagNames(t *testing.T) {
+	var s struct {
+		MaxConns int    `json:"max_connections,omitempty"`
+		Host     string `json:"-"`
+		User     string `json:",omitempty"`
+		Port     int    `json:"port" envconfig:"listen_port"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP_MAX_CONNECTIONS": "10",
+		"APP_HOST":            "localhost",
+		"APP_USER":            "admin",
+		"APP_LISTEN_PORT":     "8080",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithJSONTagNames()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 10 {
+		t.Errorf("expected %d, got %d", 10, s.MaxConns)
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.User != "admin" {
+		t.Errorf("expected %s, got %s", "admin", s.User)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+
+	s.MaxConns = 0
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.MaxConns != 0 {
+		t.Errorf("expected json tags to be ignored by default, got %d", s.MaxConns)
+	}
+}
+
+func TestBoolWords(t *testing.T) {
+	var s struct {
+		Debug   bool
+		Metrics bool
+		Tracing bool
+		Color   bool
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP_DEBUG":   "on",
+		"APP_METRICS": "Yes",
+		"APP_TRACING": "DISABLED",
+		"APP_COLOR":   "true",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	s.Tracing = true
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !s.Debug || !s.Metrics || s.Tracing || !s.Color {
+		t.Errorf("expected %v, got %+v", "Debug, Metrics and Color", s)
+	}
+
+	if os.Setenv("APP_DEBUG", "maybe") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := ProcessWithOptions(&s, WithPrefix("app")).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestWithStrictBools(t *testing.T) {
+	var s struct {
+		Debug bool
+	}
+	os.Clearenv()
+	if os.Setenv("APP_DEBUG", "1") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithStrictBools()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !s.Debug {
+		t.Errorf("expected %v, got %v", true, s.Debug)
+	}
+
+	if os.Setenv("APP_DEBUG", "on") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if _, ok := ProcessWithOptions(&s, WithPrefix("app"), WithStrictBools()).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
+
+func TestWithTrimSpace(t *testing.T) {
+	var s struct {
+		Port   int
+		Name   string
+		Ratios []float64
+		Labels map[string]int
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP_PORT":   " 8080\n",
+		"APP_NAME":   "\tkkonfig ",
+		"APP_RATIOS": "0.5, 1.5 ",
+		"APP_LABELS": "a: 1, b :2",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if _, ok := ProcessWithOptions(&s, WithPrefix("app")).(*ParseError); !ok {
+		t.Errorf("expected ParseError without WithTrimSpace")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithTrimSpace()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.Name != "kkonfig" {
+		t.Errorf("expected %q, got %q", "kkonfig", s.Name)
+	}
+	if expected := []float64{0.5, 1.5}; !reflect.DeepEqual(s.Ratios, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Ratios)
+	}
+	if expected := map[string]int{"a": 1, "b": 2}; !reflect.DeepEqual(s.Labels, expected) {
+		t.Errorf("expected %v, got %v", expected, s.Labels)
+	}
+
+	// the string values of config files are trimmed too
+	os.Clearenv()
+	var c struct {
+		Name   string
+		Tags   []string
+		Labels map[string]string
+		Port   int
+	}
+	config := strings.NewReader(`{"Name": " kkonfig\n", "Tags": [" a", "b "], "Labels": {" key ": " value "}, "Port": 8080}`)
+	if err := ProcessWithOptions(&c, WithConfigReaders(config), WithTrimSpace()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if c.Name != "kkonfig" {
+		t.Errorf("expected %q, got %q", "kkonfig", c.Name)
+	}
+	if expected := []string{"a", "b"}; !reflect.DeepEqual(c.Tags, expected) {
+		t.Errorf("expected %v, got %v", expected, c.Tags)
+	}
+	if expected := map[string]string{" key ": "value"}; !reflect.DeepEqual(c.Labels, expected) {
+		t.Errorf("expected %v, got %v", expected, c.Labels)
+	}
+	if c.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, c.Port)
+	}
+}
+
+func TestResolutionHooks(t *testing.T) {
+	var s struct {
+		Host     string `default:"localhost"`
+		Port     int    `default:"80"`
+		Database struct {
+			User string
+			Name string
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "config.json", `{"Port": 8080, "Database": {"User": "app", "Name": "db"}}`)
+	if os.Setenv("APP_HOST", "example.com") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	var events []string
+	err = ProcessWithOptions(&s,
+		WithPrefix("app"),
+		WithConfigPaths(path),
+		WithOnFileLoaded(func(name string) {
+			events = append(events, "loaded "+name)
+		}),
+		WithOnFieldSet(func(path string, origin Origin) {
+			events = append(events, fmt.Sprintf("%s %s %s", path, origin.Source, origin.Location))
+		}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := []string{
+		"Host default ",
+		"Port default ",
+		"loaded " + path,
+		"Database file " + path,
+		"Database.Name file " + path,
+		"Database.User file " + path,
+		"Port file " + path,
+		"Host env APP_HOST",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q, got %q", expected, events)
+	}
+
+	// a value that fails to parse doesn't set the field
+	if os.Setenv("APP_PORT", "x") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	events = nil
+	report := func(path string, origin Origin) {
+		events = append(events, fmt.Sprintf("%s %s %s", path, origin.Source, origin.Location))
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithConfigPaths(path), WithOnFieldSet(report)); err == nil {
+		t.Fatal("expected an error for APP_PORT")
+	}
+	for _, event := range events {
+		if strings.HasPrefix(event, "Port env") {
+			t.Errorf("expected Port not to be set by the environment, got %q", event)
+		}
+	}
+}
+
+func TestDeprecatedKeys(t *testing.T) {
+	var s struct {
+		Host    string `deprecated:"LEGACY_HOST"`
+		Port    int    `deprecated:"OLD_PORT, LEGACY_PORT"`
+		Timeout int    `deprecated:"OLD_TIMEOUT"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP_HOST":    "new",
+		"LEGACY_HOST": "old",
+		"LEGACY_PORT": "8080",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	var used []string
+	report := func(old, new string) {
+		used = append(used, old+" -> "+new)
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithOnDeprecated(report)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "new" {
+		t.Errorf("expected %s, got %s", "new", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if expected := []string{"LEGACY_PORT -> APP_PORT"}; !reflect.DeepEqual(used, expected) {
+		t.Errorf("expected %v, got %v", expected, used)
+	}
+
+	if os.Setenv("OLD_TIMEOUT", "soon") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	err := ProcessWithOptions(&s, WithPrefix("app"))
+	if v, ok := err.(*ParseError); !ok || v.KeyName != "OLD_TIMEOUT" {
+		t.Errorf("expected ParseError for OLD_TIMEOUT, got %v", err)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	var s struct {
+		ServerPort int    `aliases:"HTTP_PORT, PORT" deprecated:"OLD_PORT"`
+		Host       string `aliases:"HOSTNAME"`
+		Name       string `aliases:"SERVICE_NAME"`
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"PORT":         "8080",
+		"OLD_PORT":     "80",
+		"APP_HOST":     "example.com",
+		"HOSTNAME":     "localhost",
+		"SERVICE_NAME": "api",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	var used []string
+	report := func(old, new string) {
+		used = append(used, old)
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithOnDeprecated(report)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.ServerPort != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.ServerPort)
+	}
+	if s.Host != "example.com" {
+		t.Errorf("expected %s, got %s", "example.com", s.Host)
+	}
+	if s.Name != "api" {
+		t.Errorf("expected %s, got %s", "api", s.Name)
+	}
+	if len(used) != 0 {
+		t.Errorf("expected no deprecated keys, got %v", used)
+	}
+
+	if os.Setenv("HTTP_PORT", "9090") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.ServerPort != 9090 {
+		t.Errorf("expected %d, got %d", 9090, s.ServerPort)
+	}
+
+	os.Unsetenv("HTTP_PORT")
+	os.Unsetenv("PORT")
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithOnDeprecated(report)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.ServerPort != 80 {
+		t.Errorf("expected %d, got %d", 80, s.ServerPort)
+	}
+	if expected := []string{"OLD_PORT"}; !reflect.DeepEqual(used, expected) {
+		t.Errorf("expected %v, got %v", expected, used)
+	}
+}
+
+func TestWithKeySeparator(t *testing.T) {
+	var s struct {
+		Name string
+		DB   struct {
+			Host     string
+			MaxConns int `envconfig:"max_conns"`
+		}
+	}
+	os.Clearenv()
+	for key, value := range map[string]string{
+		"APP__NAME":          "app",
+		"APP__DB__HOST":      "localhost",
+		"APP__DB__MAX_CONNS": "10",
+		"APP_DB_HOST":        "wrong",
+	} {
+		if os.Setenv(key, value) != nil {
+			t.Errorf("Unable to use os.Setenv")
+		}
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("app"), WithKeySeparator("__")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Name != "app" {
+		t.Errorf("expected %s, got %s", "app", s.Name)
+	}
+	if s.DB.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.DB.Host)
+	}
+	if s.DB.MaxConns != 10 {
+		t.Errorf("expected %d, got %d", 10, s.DB.MaxConns)
+	}
+}
+
+func TestWithDefaultsForEmpty(t *testing.T) {
+	type specification struct {
+		Timeout time.Duration `default:"30s"`
+		Host    string        `default:"localhost"`
+		Retries int           `default:"3"`
+		Name    *string       `default:"app"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Timeout": null, "Host": "", "Retries": 5, "Name": null}`)
+
+	var s specification
+	if err := ProcessWithOptions(&s, WithConfigPaths(path)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "" {
+		t.Errorf("expected %q, got %q", "", s.Host)
+	}
+	if s.Name != nil {
+		t.Errorf("expected <nil>, got %s", *s.Name)
+	}
+
+	s = specification{}
+	if err := ProcessWithOptions(&s, WithConfigPaths(path), WithDefaultsForEmpty()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Timeout != 30*time.Second {
+		t.Errorf("expected %s, got %s", 30*time.Second, s.Timeout)
+	}
+	if s.Host != "localhost" {
+		t.Errorf("expected %s, got %s", "localhost", s.Host)
+	}
+	if s.Retries != 5 {
+		t.Errorf("expected %d, got %d", 5, s.Retries)
+	}
+	if s.Name == nil || *s.Name != "app" {
+		t.Errorf("expected %s, got %v", "app", s.Name)
+	}
+}
+
+func TestWithSourceOrder(t *testing.T) {
+	var s struct {
+		Host string `default:"default"`
+		Port int    `default:"80"`
+		User string `default:"guest"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "file", "Port": 8080}`)
+	if os.Setenv("ENV_CONFIG_HOST", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_USER", "admin") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	err = ProcessWithOptions(&s,
+		WithPrefix("env_config"),
+		WithConfigPaths(path),
+		WithSourceOrder(SourceDefault, SourceEnv, SourceFile),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "file" {
+		t.Errorf("expected %s, got %s", "file", s.Host)
+	}
+	if s.Port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, s.Port)
+	}
+	if s.User != "admin" {
+		t.Errorf("expected %s, got %s", "admin", s.User)
+	}
+
+	for _, order := range [][]Source{
+		{SourceDefault, SourceEnv},
+		{SourceDefault, SourceEnv, SourceEnv},
+		{SourceDefault, SourceFile, SourceEnv, SourceCustom},
+	} {
+		if err := ProcessWithOptions(&s, WithSourceOrder(order...)); err == nil {
+			t.Errorf("expected an error for %v", order)
+		}
+	}
+}
+
+// uuid stands in for a third-party identifier type such as uuid.UUID
+type uuid [16]byte
+
+func parseUUID(value string) (interface{}, error) {
+	var u uuid
+	b, err := hex.DecodeString(strings.Replace(value, "-", "", -1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != len(u) {
+		return nil, fmt.Errorf("invalid UUID %q", value)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+func TestWithoutLayers(t *testing.T) {
+	type spec struct {
+		Host string `default:"default"`
+		Port int    `default:"80"`
+		User string `required:"true"`
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "file"}`)
+	if os.Setenv("APP_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	for _, test := range []struct {
+		opt      Option
+		expected spec
+	}{
+		{WithoutDefaults(), spec{Host: "file", Port: 8080}},
+		{WithoutJSON(), spec{Host: "default", Port: 8080}},
+		{WithoutEnv(), spec{Host: "file", Port: 80}},
+	} {
+		var s spec
+		if err := ProcessWithOptions(&s, WithPrefix("app"), WithConfigPaths(path), test.opt); err != nil {
+			t.Fatal(err.Error())
+		}
+		if s != test.expected {
+			t.Errorf("expected %+v, got %+v", test.expected, s)
+		}
+	}
+
+	var s spec
+	err = ProcessWithOptions(&s, WithPrefix("app"), WithConfigPaths(path))
+	if _, ok := err.(*RequiredError); !ok {
+		t.Errorf("expected RequiredError, got %v", err)
+	}
+}
+
+type CollidingEmbedded struct {
+	Host string
+}
+
+func TestWithCheckKeyCollisions(t *testing.T) {
+	var s struct {
+		CollidingEmbedded
+		Host    string
+		Primary string `envconfig:"db_host"`
+		DB      struct {
+			Host string
+		}
+		Port int
+	}
+	os.Clearenv()
+	if err := ProcessWithOptions(&s, WithPrefix("app")); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err := ProcessWithOptions(&s, WithPrefix("app"), WithCheckKeyCollisions())
+	aggregate, ok := err.(*AggregateError)
+	if !ok {
+		t.Fatalf("expected AggregateError, got %v", err)
+	}
+	expected := []error{
+		&KeyCollisionError{Key: "APP_HOST", Paths: []string{"CollidingEmbedded.Host", "Host"}},
+		&KeyCollisionError{Key: "APP_DB_HOST", Paths: []string{"Primary", "DB.Host"}},
+	}
+	if !reflect.DeepEqual(aggregate.Errors, expected) {
+		t.Errorf("expected %v, got %v", expected, aggregate.Errors)
+	}
+
+	var single struct {
+		Primary string `envconfig:"port"`
+		Port    int
+	}
+	err = ProcessWithOptions(&single, WithPrefix("app"), WithCheckKeyCollisions())
+	if v, ok := err.(*KeyCollisionError); !ok || v.Error() != "kkonfig: key APP_PORT is used by Primary and Port" {
+		t.Errorf("expected KeyCollisionError, got %v", err)
+	}
+}
+
+func TestWithDecoderValueTypes(t *testing.T) {
+	var s struct {
+		ID      uuid
+		Peers   []uuid
+		Weights map[uuid]int
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_ID", "6ba7b810-9dad-11d1-80b4-00c04fd430c8") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PEERS", "6ba7b811-9dad-11d1-80b4-00c04fd430c8,6ba7b812-9dad-11d1-80b4-00c04fd430c8") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_WEIGHTS", "6ba7b811-9dad-11d1-80b4-00c04fd430c8:2") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	err := ProcessWithOptions(&s, WithPrefix("env_config"), WithDecoder(reflect.TypeOf(uuid{}), parseUUID))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.ID[0] != 0x6b || s.ID[15] != 0xc8 {
+		t.Errorf("expected %s, got %x", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", s.ID)
+	}
+	if len(s.Peers) != 2 || s.Peers[1][3] != 0x12 {
+		t.Errorf("expected 2 peers, got %x", s.Peers)
+	}
+	if len(s.Weights) != 1 || s.Weights[s.Peers[0]] != 2 {
+		t.Errorf("expected %d, got %v", 2, s.Weights)
+	}
+
+	// without the decoder the array is parsed element by element
+	if _, ok := Process("env_config", nil, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError without a registered decoder")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// ReloadOnSignal installs a handler that re-runs Process each time the process
+// receives sig, and calls onReload with the result. The returned function
+// uninstalls the handler.
+//
+// spec is either a pointer to a struct or an *atomic.Value holding one. Every
+// reload is processed into a fresh copy of the spec, so a failed reload leaves
+// the current config untouched. An *atomic.Value is updated by swapping in
+// the fresh copy, so concurrent readers never observe a partially updated
+// config. A struct pointer is overwritten in place and must not be read
+// concurrently.
+func ReloadOnSignal(sig os.Signal, prefix string, configPaths []string, spec interface{}, onReload func(error)) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(signals, sig)
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				err := reload(prefix, configPaths, spec)
+				if onReload != nil {
+					onReload(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// reload processes a fresh copy of spec and swaps it in if it succeeds
+func reload(prefix string, configPaths []string, spec interface{}) error {
+	if v, ok := spec.(*atomic.Value); ok {
+		current := v.Load()
+		if current == nil {
+			return errors.New("kkonfig: atomic.Value holds no specification")
+		}
+		if err := checkSpec(current); err != nil {
+			return err
+		}
+		fresh := reflect.New(reflect.TypeOf(current).Elem())
+		if err := Process(prefix, configPaths, fresh.Interface()); err != nil {
+			return err
+		}
+		v.Store(fresh.Interface())
+		return nil
+	}
+
+	if err := checkSpec(spec); err != nil {
+		return err
+	}
+	fresh := reflect.New(reflect.TypeOf(spec).Elem())
+	if err := Process(prefix, configPaths, fresh.Interface()); err != nil {
+		return err
+	}
+	reflect.ValueOf(spec).Elem().Set(fresh.Elem())
+	return nil
+}
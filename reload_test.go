@@ -0,0 +1,91 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type reloadSpecification struct {
+	Port int `default:"80"`
+}
+
+func sendSignal(t *testing.T, sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(sig); err != nil {
+		t.Skipf("Unable to send %s: %s", sig, err)
+	}
+}
+
+func waitForReload(t *testing.T, reloads chan error) error {
+	select {
+	case err := <-reloads:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reload")
+		return nil
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	var v atomic.Value
+	v.Store(&reloadSpecification{Port: 80})
+	os.Clearenv()
+
+	reloads := make(chan error, 1)
+	stop := ReloadOnSignal(syscall.SIGHUP, "env_config", nil, &v, func(err error) {
+		reloads <- err
+	})
+	defer stop()
+
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	sendSignal(t, syscall.SIGHUP)
+	if err := waitForReload(t, reloads); err != nil {
+		t.Fatal(err.Error())
+	}
+	if port := v.Load().(*reloadSpecification).Port; port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, port)
+	}
+
+	// a failed reload leaves the current config in place
+	if os.Setenv("ENV_CONFIG_PORT", "eighty") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	sendSignal(t, syscall.SIGHUP)
+	if err := waitForReload(t, reloads); err == nil {
+		t.Error("expected the reload to fail")
+	}
+	if port := v.Load().(*reloadSpecification).Port; port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, port)
+	}
+}
+
+func TestReloadOnSignalStructPointer(t *testing.T) {
+	s := reloadSpecification{Port: 1}
+	os.Clearenv()
+
+	reloads := make(chan error, 1)
+	stop := ReloadOnSignal(syscall.SIGHUP, "env_config", nil, &s, func(err error) {
+		reloads <- err
+	})
+	defer stop()
+
+	sendSignal(t, syscall.SIGHUP)
+	if err := waitForReload(t, reloads); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Port != 80 {
+		t.Errorf("expected %d, got %d", 80, s.Port)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+// Source identifies the layer that gave a field its value.
+type Source int
+
+const (
+	// SourceUnset means that no layer gave the field a value.
+	SourceUnset Source = iota
+	// SourceDefault means the value came from the field's default tag.
+	SourceDefault
+	// SourceFile means the value came from a config file.
+	SourceFile
+	// SourceEnv means the value came from an environment variable.
+	SourceEnv
+	// SourceCustom means the value came from a ConfigSource.
+	SourceCustom
+	// SourceFlag means the value came from a command-line flag.
+	SourceFlag
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceFile:
+		return "file"
+	case SourceEnv:
+		return "env"
+	case SourceCustom:
+		return "custom"
+	case SourceFlag:
+		return "flag"
+	}
+	return "unset"
+}
+
+// Origin describes where a field got its value from. Location holds the
+// path of the config file for SourceFile, and the key that was looked up for
+// SourceEnv, SourceCustom and SourceFlag.
+type Origin struct {
+	Source   Source
+	Location string
+}
+
+// A Report maps the paths of the fields of a specification, such as
+// Database.Host, to the origin of their final values.
+type Report map[string]Origin
+
+// WasSet reports whether the field at path, such as Database.Host, was given
+// a value by a config file, the environment, a ConfigSource or a flag. A
+// value that only comes from a default doesn't count, so that a field, such
+// as a pointer with a default, can still tell "not provided" apart from its
+// default.
+func (r Report) WasSet(path string) bool {
+	switch r[path].Source {
+	case SourceUnset, SourceDefault:
+		return false
+	}
+	return true
+}
+
+// ProcessWithReport is the same as Process, but also reports which layer
+// each field got its final value from.
+func ProcessWithReport(prefix string, configPaths []string, spec interface{}) (Report, error) {
+	var report Report
+	if err := ProcessWithOptions(spec, WithPrefix(prefix), WithConfigPaths(configPaths...), WithReport(&report)); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func newReport(o *options, spec interface{}) Report {
+	report := make(Report)
+	for _, info := range gatherInfo(o, o.prefix, spec) {
+		report[info.Path] = o.origins[info.Path]
+	}
+	return report
+}
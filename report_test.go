@@ -0,0 +1,101 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestProcessWithReport(t *testing.T) {
+	var s struct {
+		Debug    bool
+		Port     int `default:"80"`
+		Host     string
+		Database struct {
+			Host string
+			Port int `default:"5432"`
+		}
+	}
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Host": "localhost", "Database": {"Host": "db.local"}}`)
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+
+	report, err := ProcessWithReport("env_config", []string{path}, &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := Report{
+		"Debug":         {Source: SourceUnset},
+		"Port":          {Source: SourceEnv, Location: "ENV_CONFIG_PORT"},
+		"Host":          {Source: SourceFile, Location: path},
+		"Database.Host": {Source: SourceFile, Location: path},
+		"Database.Port": {Source: SourceDefault},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Errorf("expected %v, got %v", expected, report)
+	}
+}
+
+func TestReportWasSet(t *testing.T) {
+	var s struct {
+		Retries *int
+		Timeout *int `default:"30"`
+		Workers *int `default:"4"`
+		Limit   *int
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_WORKERS", "8") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeConfigFile(t, dir, "config.json", `{"Limit": 10}`)
+
+	report, err := ProcessWithReport("env_config", []string{path}, &s)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Retries != nil {
+		t.Errorf("expected nil, got %v", *s.Retries)
+	}
+	if s.Timeout == nil || *s.Timeout != 30 {
+		t.Errorf("expected %d, got %v", 30, s.Timeout)
+	}
+	for path, expected := range map[string]bool{
+		"Retries": false,
+		"Timeout": false,
+		"Workers": true,
+		"Limit":   true,
+		"Missing": false,
+	} {
+		if set := report.WasSet(path); set != expected {
+			t.Errorf("expected WasSet(%s) to be %v, got %v", path, expected, set)
+		}
+	}
+
+	// the same report is available with options
+	var withOptions Report
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithConfigPaths(path), WithReport(&withOptions)); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !withOptions.WasSet("Workers") || withOptions.WasSet("Timeout") {
+		t.Errorf("expected only Workers to be set, got %v", withOptions)
+	}
+}
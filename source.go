@@ -0,0 +1,46 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+// A ConfigSource provides config values by key, such as a key-value store or
+// a settings table in a database. Keys are derived from the specification in
+// the same way as environment variable names.
+type ConfigSource interface {
+	Lookup(key string) (string, bool)
+}
+
+// SourcePrecedence defines where a ConfigSource is consulted relative to the
+// default values, config files and environment variables.
+type SourcePrecedence int
+
+const (
+	// SourceBeforeJSON consults the source after the default values have
+	// been applied, so config files and the environment override it.
+	SourceBeforeJSON SourcePrecedence = iota
+	// SourceBeforeEnv consults the source after the config files, so only
+	// the environment overrides it.
+	SourceBeforeEnv
+	// SourceAfterEnv consults the source last, so it overrides everything.
+	SourceAfterEnv
+)
+
+type prioritizedSource struct {
+	src        ConfigSource
+	precedence SourcePrecedence
+}
+
+// processSources populates spec from the sources registered at precedence p,
+// in the order they were registered.
+func processSources(o *options, p SourcePrecedence, spec interface{}) error {
+	for _, s := range o.sources {
+		if s.precedence != p {
+			continue
+		}
+		if err := processSource(o, o.prefix, spec, s.src, SourceCustom); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+type sourceSpecification struct {
+	FromSource string
+	FromJSON   string
+	FromEnv    string
+	Nested     struct {
+		Port int
+	}
+}
+
+func processWithSource(t *testing.T, p SourcePrecedence) sourceSpecification {
+	var s sourceSpecification
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"FromJSON": "json", "FromEnv": "json"}`)
+	if os.Setenv("ENV_CONFIG_FROMENV", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	src := mapLookuper{
+		"ENV_CONFIG_FROMSOURCE":  "source",
+		"ENV_CONFIG_FROMJSON":    "source",
+		"ENV_CONFIG_FROMENV":     "source",
+		"ENV_CONFIG_NESTED_PORT": "8080",
+	}
+
+	err = ProcessWithOptions(&s,
+		WithPrefix("env_config"),
+		WithConfigPaths(path),
+		WithConfigSource(src, p),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return s
+}
+
+func TestConfigSource(t *testing.T) {
+	tests := []struct {
+		precedence SourcePrecedence
+		fromJSON   string
+		fromEnv    string
+	}{
+		{SourceBeforeJSON, "json", "env"},
+		{SourceBeforeEnv, "source", "env"},
+		{SourceAfterEnv, "source", "source"},
+	}
+	for _, test := range tests {
+		s := processWithSource(t, test.precedence)
+		if s.FromSource != "source" {
+			t.Errorf("%d: expected %q, got %q", test.precedence, "source", s.FromSource)
+		}
+		if s.FromJSON != test.fromJSON {
+			t.Errorf("%d: expected %q, got %q", test.precedence, test.fromJSON, s.FromJSON)
+		}
+		if s.FromEnv != test.fromEnv {
+			t.Errorf("%d: expected %q, got %q", test.precedence, test.fromEnv, s.FromEnv)
+		}
+		if s.Nested.Port != 8080 {
+			t.Errorf("%d: expected %d, got %d", test.precedence, 8080, s.Nested.Port)
+		}
+	}
+}
+
+func TestProcessMap(t *testing.T) {
+	var s struct {
+		Host    string
+		Port    int    `default:"80"`
+		Secret  string `default:"${ENV_CONFIG_HOST}-key"`
+		Missing string
+	}
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_MISSING", "env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	values := map[string]string{
+		"ENV_CONFIG_HOST": "example.com",
+	}
+	if err := ProcessMap("env_config", values, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Host != "example.com" {
+		t.Errorf("expected %s, got %s", "example.com", s.Host)
+	}
+	if s.Port != 80 {
+		t.Errorf("expected %d, got %d", 80, s.Port)
+	}
+	if s.Secret != "example.com-key" {
+		t.Errorf("expected %s, got %s", "example.com-key", s.Secret)
+	}
+	if s.Missing != "" {
+		t.Errorf("expected the environment to be ignored, got %s", s.Missing)
+	}
+
+	values["ENV_CONFIG_PORT"] = "eighty"
+	if _, ok := ProcessMap("env_config", values, &s).(*ParseError); !ok {
+		t.Errorf("expected ParseError")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"os"
+)
+
+// templateResolver expands the environment values of fields tagged with
+// `template:"true"`. A template references other fields by their path, e.g.
+// ${Host} or ${Database.Port}, and referenced templates are resolved first.
+type templateResolver struct {
+	o         *options
+	fields    map[string]varInfo
+	templates map[string]templateValue
+	resolving map[string]bool
+}
+
+// templateValue is the value of a templated field before it is expanded, and
+// where it came from, which is recorded once the field is set.
+type templateValue struct {
+	value  string
+	origin Origin
+}
+
+func resolveTemplates(o *options, infos []varInfo, templates map[string]templateValue) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	r := &templateResolver{
+		o:         o,
+		fields:    make(map[string]varInfo, len(infos)),
+		templates: templates,
+		resolving: make(map[string]bool),
+	}
+	for _, info := range infos {
+		r.fields[info.Path] = info
+	}
+
+	// resolve in field order so that errors are deterministic
+	for _, info := range infos {
+		if err := r.resolve(info.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *templateResolver) resolve(path string) error {
+	template, ok := r.templates[path]
+	if !ok {
+		return nil
+	}
+	if r.resolving[path] {
+		return fmt.Errorf("kkonfig: template cycle detected at %s", path)
+	}
+	r.resolving[path] = true
+
+	info := r.fields[path]
+	var err error
+	expanded := os.Expand(template.value, func(ref string) string {
+		if err != nil {
+			return ""
+		}
+		if err = r.resolve(ref); err != nil {
+			return ""
+		}
+		target, ok := r.fields[ref]
+		if !ok {
+			err = fmt.Errorf("kkonfig: %s references unknown field %s", info.Key, ref)
+			return ""
+		}
+		// a field counts as set once it was given a value, even a zero one,
+		// or when the spec already held one
+		if _, set := r.o.origins[ref]; !set && target.Field.IsZero() {
+			if !r.o.blankTemplateRefs {
+				err = fmt.Errorf("kkonfig: %s references unset field %s", info.Key, ref)
+			}
+			return ""
+		}
+		return formatValue(target.Field)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := processField(r.o, expanded, info.Field, info.Tags); err != nil {
+		err = r.o.fail(newParseError(info.Key, info.Name, info.Field, info.Tags, expanded, err))
+		if err != nil {
+			return err
+		}
+	} else {
+		r.o.setOrigin(path, template.origin)
+	}
+
+	delete(r.templates, path)
+	delete(r.resolving, path)
+	return nil
+}
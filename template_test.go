@@ -0,0 +1,120 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"os"
+	"testing"
+)
+
+type templateSpecification struct {
+	BaseURL  string `template:"true"`
+	Host     string
+	Port     int    `default:"8080"`
+	Endpoint string `template:"true"`
+	Literal  string
+	Database struct {
+		Name string
+		DSN  string `template:"true"`
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	var s templateSpecification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BASEURL", "https://${Host}:${Port}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_HOST", "example.com") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_ENDPOINT", "${BaseURL}/api") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_LITERAL", "${Host}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_DATABASE_NAME", "app") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_DATABASE_DSN", "postgres://${Host}/${Database.Name}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if want := "https://example.com:8080"; s.BaseURL != want {
+		t.Errorf("expected %q, got %q", want, s.BaseURL)
+	}
+	if want := "https://example.com:8080/api"; s.Endpoint != want {
+		t.Errorf("expected %q, got %q", want, s.Endpoint)
+	}
+	if want := "${Host}"; s.Literal != want {
+		t.Errorf("expected %q, got %q", want, s.Literal)
+	}
+	if want := "postgres://example.com/app"; s.Database.DSN != want {
+		t.Errorf("expected %q, got %q", want, s.Database.DSN)
+	}
+}
+
+func TestTemplateCycle(t *testing.T) {
+	var s templateSpecification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BASEURL", "${Endpoint}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_ENDPOINT", "${BaseURL}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err == nil {
+		t.Error("expected an error for a template cycle")
+	}
+}
+
+func TestTemplateUnsetReference(t *testing.T) {
+	var s templateSpecification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BASEURL", "https://${Host}:${Port}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err == nil {
+		t.Error("expected an error for a reference to an unset field")
+	}
+
+	s = templateSpecification{}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithBlankTemplateRefs()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if want := "https://:8080"; s.BaseURL != want {
+		t.Errorf("expected %q, got %q", want, s.BaseURL)
+	}
+
+	// zero values that were given are set
+	if os.Setenv("ENV_CONFIG_HOST", "") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_PORT", "0") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	s = templateSpecification{}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+	if want := "https://:0"; s.BaseURL != want {
+		t.Errorf("expected %q, got %q", want, s.BaseURL)
+	}
+}
+
+func TestTemplateUnknownReference(t *testing.T) {
+	var s templateSpecification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_BASEURL", "${Hostname}") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := ProcessWithOptions(&s, WithPrefix("env_config"), WithBlankTemplateRefs()); err == nil {
+		t.Error("expected an error for a reference to an unknown field")
+	}
+}
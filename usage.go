@@ -0,0 +1,178 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	decoderType     = reflect.TypeOf((*Decoder)(nil)).Elem()
+	setterType      = reflect.TypeOf((*Setter)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	binaryType      = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+	durationType    = reflect.TypeOf(time.Duration(0))
+)
+
+// Usage writes a table of the environment variables that Process reads for
+// spec to out, along with their types, default values, whether they are
+// required and their desc and example tags.
+func Usage(prefix string, spec interface{}, out io.Writer) error {
+	return UsageWithOptions(spec, out, WithPrefix(prefix))
+}
+
+// UsageWithOptions is the same as Usage, configured by the given options, so
+// that the keys match those of ProcessWithOptions with the same options.
+func UsageWithOptions(spec interface{}, out io.Writer, opts ...Option) error {
+	if err := checkSpec(spec); err != nil {
+		return err
+	}
+
+	o := newOptions(opts)
+	o.nilStructs = zeroNilStructs
+	tabs := tabwriter.NewWriter(out, 1, 0, 4, ' ', 0)
+	fmt.Fprintln(tabs, "KEY\tTYPE\tDEFAULT\tREQUIRED\tDESCRIPTION")
+	for _, info := range gatherInfo(o, o.prefix, spec) {
+		required := ""
+		if info.Tags.Get("required") == "true" {
+			required = "true"
+		}
+		desc := info.Tags.Get("desc")
+		if example := info.Tags.Get("example"); example != "" {
+			desc = strings.TrimSpace(fmt.Sprintf("%s (e.g. %s)", desc, example))
+		}
+		fmt.Fprintf(tabs, "%s\t%s\t%s\t%s\t%s\n", info.Key, typeDescription(info.Field.Type(), info.Tags), info.Tags.Get("default"), required, desc)
+	}
+	return tabs.Flush()
+}
+
+// Keys returns the names of the environment variables that Process looks up
+// for spec, in field order, such as for checking that a deployment sets every
+// required key. It includes the variables named by `aliases`, `deprecated`
+// and `file` tags and those that set the length of slices of structs, and
+// returns nil if spec is not a struct pointer.
+func Keys(prefix string, spec interface{}) []string {
+	return KeysWithOptions(spec, WithPrefix(prefix))
+}
+
+// KeysWithOptions is the same as Keys, configured by the given options, so
+// that the keys match those ProcessWithOptions looks up with the same options.
+func KeysWithOptions(spec interface{}, opts ...Option) []string {
+	if checkSpec(spec) != nil {
+		return nil
+	}
+
+	o := newOptions(opts)
+	o.nilStructs = zeroNilStructs
+	return lookupKeys(o, o.prefix, spec)
+}
+
+// lookupKeys returns the keys the environment layer looks up for spec
+func lookupKeys(o *options, prefix string, spec interface{}) []string {
+	var keys []string
+	for _, info := range gatherInfo(o, prefix, spec) {
+		keys = append(keys, info.Key)
+		alternates, _ := alternateKeys(info.Tags)
+		keys = append(keys, alternates...)
+		if name := info.Tags.Get("file"); name != "" {
+			keys = append(keys, name)
+		}
+	}
+	for _, info := range gatherStructSlices(o, prefix, spec) {
+		keys = append(keys, info.Key)
+	}
+	return keys
+}
+
+// elemDescription is typeDescription for the elements of a list or map, which
+// are described in the middle of a sentence.
+func elemDescription(t reflect.Type, tag reflect.StructTag) string {
+	desc := typeDescription(t, tag)
+	if strings.HasPrefix(desc, "One of ") {
+		desc = "one of " + strings.TrimPrefix(desc, "One of ")
+	}
+	return desc
+}
+
+// typeDescription describes the values a field of type t accepts, in terms
+// that make sense to someone setting environment variables.
+func typeDescription(t reflect.Type, tag reflect.StructTag) string {
+	if implementsParser(t) || isStandardType(t) {
+		return t.String()
+	}
+	if t.Kind() == reflect.Ptr {
+		return typeDescription(t.Elem(), tag)
+	}
+	if t == durationType {
+		return "Duration"
+	}
+	if isNullable(t) {
+		return typeDescription(t.Field(0).Type, tag)
+	}
+	if oneof := tag.Get("oneof"); oneof != "" && t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map {
+		var allowed []string
+		for _, entry := range strings.Fields(oneof) {
+			allowed = append(allowed, strings.Split(entry, "|")[0])
+		}
+		return "One of " + strings.Join(allowed, ", ")
+	}
+	if tag.Get("format") == "bytesize" && t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64 {
+		return "Byte size"
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return "String"
+	case reflect.Bool:
+		return "True or False"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "Integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Unsigned Integer"
+	case reflect.Float32, reflect.Float64:
+		return "Float"
+	case reflect.Complex64, reflect.Complex128:
+		return "Complex"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			switch tag.Get("encoding") {
+			case "hex":
+				return "Hex"
+			case "raw":
+				return "String"
+			}
+			return "Base64"
+		}
+		return fmt.Sprintf("List of %s separated by %q", elemDescription(t.Elem(), tag), delimiterFrom(tag))
+	case reflect.Array:
+		return fmt.Sprintf("List of %d %s separated by %q", t.Len(), elemDescription(t.Elem(), tag), delimiterFrom(tag))
+	case reflect.Map:
+		if tag.Get("format") == "querystring" {
+			return "Query string"
+		}
+		separator := tag.Get("separator")
+		if separator == "" {
+			separator = ":"
+		}
+		return fmt.Sprintf("Map of %s%s%s pairs separated by %q", elemDescription(t.Key(), tag), separator, elemDescription(t.Elem(), tag), delimiterFrom(tag))
+	}
+	return t.String()
+}
+
+// implementsParser reports whether t or *t parses itself
+func implementsParser(t reflect.Type) bool {
+	for _, iface := range []reflect.Type{decoderType, setterType, unmarshalerType, binaryType} {
+		if t.Implements(iface) || reflect.PtrTo(t).Implements(iface) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type usageSpecification struct {
+	Port     int           `default:"8080"`
+	Timeout  time.Duration `required:"true" desc:"request timeout" example:"30s"`
+	Database struct {
+		Host string `envconfig:"hostname"`
+	}
+	Ignored string `ignored:"true"`
+}
+
+func TestUsage(t *testing.T) {
+	var s usageSpecification
+	var buf bytes.Buffer
+	if err := Usage("env_config", &s, &buf); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	expected := [][]string{
+		{"KEY", "TYPE", "DEFAULT", "REQUIRED", "DESCRIPTION"},
+		{"ENV_CONFIG_PORT", "Integer", "8080"},
+		{"ENV_CONFIG_TIMEOUT", "Duration", "true", "request", "timeout", "(e.g.", "30s)"},
+		{"ENV_CONFIG_DATABASE_HOSTNAME", "String"},
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got\n%s", len(expected), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(expected[i], " ") {
+			t.Errorf("line %d: expected %q, got %q", i, expected[i], got)
+		}
+	}
+
+	buf.Reset()
+	if err := UsageWithOptions(&s, &buf, WithPrefix("env_config"), WithKeySeparator("__")); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !strings.Contains(buf.String(), "ENV_CONFIG__DATABASE__HOSTNAME") {
+		t.Errorf("expected the keys to use the separator, got\n%s", buf.String())
+	}
+}
+
+func TestTypeDescription(t *testing.T) {
+	var s struct {
+		Debug    bool
+		Users    []string
+		Limits   map[string]uint `delimiter:";" separator:"="`
+		Rate     *float64
+		Datetime time.Time
+		Level    bracketed
+		Mode     string   `oneof:"dev|development prod"`
+		Modes    []string `oneof:"dev prod"`
+		MaxRows  sql.NullInt64
+	}
+	typ := reflect.TypeOf(s)
+	expected := []string{
+		"True or False",
+		`List of String separated by ","`,
+		`Map of String=Unsigned Integer pairs separated by ";"`,
+		"Float",
+		"time.Time",
+		"kkonfig.bracketed",
+		"One of dev, prod",
+		`List of one of dev, prod separated by ","`,
+		"Integer",
+	}
+	for i, want := range expected {
+		field := typ.Field(i)
+		if got := typeDescription(field.Type, field.Tag); got != want {
+			t.Errorf("%s: expected %q, got %q", field.Name, want, got)
+		}
+	}
+}
+
+func TestUsageInvalidSpecification(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Usage("env_config", usageSpecification{}, &buf); !errors.Is(err, ErrInvalidSpecification) {
+		t.Errorf("expected %v, got %v", ErrInvalidSpecification, err)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	var s struct {
+		Port     int
+		Database struct {
+			Host string `envconfig:"hostname"`
+		}
+		Ignored  string `ignored:"true"`
+		APIKey   string `split_words:"true" deprecated:"OLD_KEY" file:"API_KEY_FILE"`
+		Replicas *struct {
+			Count int
+		}
+	}
+	expected := []string{
+		"ENV_CONFIG_PORT",
+		"ENV_CONFIG_DATABASE_HOSTNAME",
+		"ENV_CONFIG_API_KEY",
+		"OLD_KEY",
+		"API_KEY_FILE",
+		"ENV_CONFIG_REPLICAS_COUNT",
+	}
+	if keys := Keys("env_config", &s); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+	if s.Replicas != nil {
+		t.Errorf("expected Replicas to be left nil, got %v", s.Replicas)
+	}
+	if err := Usage("env_config", &s, ioutil.Discard); err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Replicas != nil {
+		t.Errorf("expected Replicas to be left nil, got %v", s.Replicas)
+	}
+	if keys := Keys("env_config", s); keys != nil {
+		t.Errorf("expected nil for an invalid specification, got %v", keys)
+	}
+
+	// the keys follow the options processing is configured with
+	expected = []string{
+		"ENV_CONFIG__PORT",
+		"ENV_CONFIG__DATABASE__HOSTNAME",
+		"ENV_CONFIG__API_KEY",
+		"OLD_KEY",
+		"API_KEY_FILE",
+		"ENV_CONFIG__REPLICAS__COUNT",
+	}
+	if keys := KeysWithOptions(&s, WithPrefix("env_config"), WithKeySeparator("__"), WithSplitWords()); !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected %v, got %v", expected, keys)
+	}
+}
+
+func TestProcessOrUsage(t *testing.T) {
+	var s usageSpecification
+	var buf bytes.Buffer
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "eighty") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if ProcessOrUsage("env_config", nil, &s, &buf) {
+		t.Fatal("expected ProcessOrUsage to fail")
+	}
+	if !strings.Contains(buf.String(), "converting 'eighty' to type int") {
+		t.Errorf("expected the error in the output, got\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "ENV_CONFIG_TIMEOUT") {
+		t.Errorf("expected the usage table in the output, got\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if os.Setenv("ENV_CONFIG_PORT", "80") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if ProcessOrUsage("env_config", nil, &s, &buf) {
+		t.Fatal("expected ProcessOrUsage to fail")
+	}
+	if !strings.Contains(buf.String(), "missing required ENV_CONFIG_TIMEOUT") {
+		t.Errorf("expected the error in the output, got\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if os.Setenv("ENV_CONFIG_TIMEOUT", "30s") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if !ProcessOrUsage("env_config", nil, &s, &buf) {
+		t.Errorf("expected ProcessOrUsage to succeed, got\n%s", buf.String())
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no output, got\n%s", buf.String())
+	}
+}
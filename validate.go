@@ -0,0 +1,123 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Validator is implemented by specifications, and by the types of their
+// nested struct fields, that check invariants across their fields once every
+// layer has been processed.
+type Validator interface {
+	Validate() error
+}
+
+// Validate runs every step of Process against a new zero value of the type of
+// spec, which may be a struct, a pointer to one or its reflect.Type, and
+// returns the errors Process would. spec itself is never modified, so that a
+// config can be checked, for example in CI, without touching a live
+// specification. Key collisions are reported too, and field errors are
+// returned together as an *AggregateError.
+func Validate(prefix string, configPaths []string, spec interface{}) error {
+	return ValidateWithOptions(spec, WithPrefix(prefix), WithConfigPaths(configPaths...))
+}
+
+// ValidateWithOptions is the same as Validate, configured by the given
+// options. With WithLookuper the process environment isn't read at all.
+func ValidateWithOptions(spec interface{}, opts ...Option) error {
+	t, ok := spec.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(spec)
+	}
+	if t == nil {
+		return &InvalidSpecificationError{Kind: reflect.Invalid}
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return &InvalidSpecificationError{Kind: t.Kind()}
+	}
+
+	opts = append([]Option{WithCheckKeyCollisions(), WithErrorAggregation()}, opts...)
+	return process(newOptions(opts), reflect.New(t).Interface())
+}
+
+// validate calls Validate on the nested structs of v and then on v itself, so
+// that component-level validators run before those that depend on them. The
+// returned error names the path of the struct that failed.
+func validate(o *options, path string, v reflect.Value) error {
+	v = derefStruct(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if err := validateFields(o, path, v); err != nil {
+		return err
+	}
+
+	var validator Validator
+	interfaceFrom(v, func(v interface{}, ok *bool) { validator, *ok = v.(Validator) })
+	if validator == nil {
+		return nil
+	}
+	if err := validator.Validate(); err != nil {
+		if path == "" {
+			return fmt.Errorf("kkonfig: validating %s: %w", v.Type(), err)
+		}
+		return fmt.Errorf("kkonfig: validating %s: %w", path, err)
+	}
+	return nil
+}
+
+// validateFields validates the nested structs of the struct v. The Validate
+// method of an embedded struct is promoted to v, so only its fields are
+// walked.
+func validateFields(o *options, path string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		ftype := t.Field(i)
+		if isIgnored(o, ftype) {
+			continue
+		}
+
+		if ftype.Anonymous {
+			if f := derefStruct(v.Field(i)); f.IsValid() {
+				if err := validateFields(o, path, f); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if ftype.PkgPath != "" {
+			continue
+		}
+
+		fieldPath := ftype.Name
+		if path != "" {
+			fieldPath = path + "." + fieldPath
+		}
+		if err := validate(o, fieldPath, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// derefStruct follows the pointers of v to the struct they point to. It
+// returns an invalid value if v doesn't lead to a struct.
+func derefStruct(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	return v
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var errMissingCert = errors.New("CertPath must be set when TLS is enabled")
+
+type tlsConfig struct {
+	Enabled  bool
+	CertPath string
+}
+
+func (c tlsConfig) Validate() error {
+	if c.Enabled && c.CertPath == "" {
+		return errMissingCert
+	}
+	return nil
+}
+
+type validatedSpecification struct {
+	Port int
+	TLS  *tlsConfig
+}
+
+func (s *validatedSpecification) Validate() error {
+	if s.Port == 0 {
+		return errors.New("Port must be set")
+	}
+	return nil
+}
+
+func TestValidate(t *testing.T) {
+	var s validatedSpecification
+	os.Clearenv()
+	if os.Setenv("ENV_CONFIG_PORT", "8080") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TLS_ENABLED", "true") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if os.Setenv("ENV_CONFIG_TLS_CERTPATH", "/etc/tls/cert.pem") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	if err := Process("env_config", nil, &s); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if os.Unsetenv("ENV_CONFIG_TLS_CERTPATH") != nil {
+		t.Errorf("Unable to use os.Unsetenv")
+	}
+	s = validatedSpecification{}
+	err := Process("env_config", nil, &s)
+	if !errors.Is(err, errMissingCert) {
+		t.Fatalf("expected %v, got %v", errMissingCert, err)
+	}
+	if !strings.Contains(err.Error(), "TLS") {
+		t.Errorf("expected %q to name the TLS field", err.Error())
+	}
+
+	if os.Unsetenv("ENV_CONFIG_PORT") != nil {
+		t.Errorf("Unable to use os.Unsetenv")
+	}
+	if os.Setenv("ENV_CONFIG_TLS_ENABLED", "false") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	s = validatedSpecification{}
+	if err := Process("env_config", nil, &s); err == nil || !strings.Contains(err.Error(), "Port must be set") {
+		t.Errorf("expected the specification to be validated, got %v", err)
+	}
+}
+
+func TestValidateDryRun(t *testing.T) {
+	type specification struct {
+		Host string `required:"true"`
+		Port int
+	}
+	s := specification{Host: "live", Port: 1}
+	os.Clearenv()
+	if os.Setenv("APP_HOST", "from-env") != nil {
+		t.Errorf("Unable to use os.Setenv")
+	}
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := writeConfigFile(t, dir, "valid.json", `{"Port": 8080}`)
+	invalid := writeConfigFile(t, dir, "invalid.json", `{"Port": "eighty"}`)
+
+	if err := Validate("app", []string{valid}, &s); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+	if s.Host != "live" || s.Port != 1 {
+		t.Errorf("expected the specification to be left alone, got %+v", s)
+	}
+	if err := Validate("app", []string{invalid}, s); err == nil {
+		t.Errorf("expected an error for an invalid config file")
+	}
+
+	// the environment isn't read with a Lookuper, so Host is missing
+	err = ValidateWithOptions(reflect.TypeOf(s), WithPrefix("app"), WithLookuper(MapLookuper(map[string]string{
+		"APP_PORT": "eighty",
+	})))
+	v, ok := err.(*AggregateError)
+	if !ok || len(v.Errors) != 2 {
+		t.Fatalf("expected an AggregateError with 2 errors, got %v", err)
+	}
+	if _, ok := v.Errors[0].(*ParseError); !ok {
+		t.Errorf("expected ParseError, got %v", v.Errors[0])
+	}
+	if _, ok := v.Errors[1].(*RequiredError); !ok {
+		t.Errorf("expected RequiredError, got %v", v.Errors[1])
+	}
+
+	if err := Validate("app", nil, 42); !errors.Is(err, ErrInvalidSpecification) {
+		t.Errorf("expected %v, got %v", ErrInvalidSpecification, err)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/fs"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Watcher keeps a specification up to date with its config files. It polls
+// the files at an interval and re-runs the pipeline when one of them changes.
+type Watcher struct {
+	spec     atomic.Value
+	opts     []Option
+	onChange func(old, new interface{})
+
+	mu     sync.Mutex
+	err    error
+	stamps map[string]fileStamp
+
+	done chan struct{}
+	once sync.Once
+}
+
+// fileStamp identifies a version of a watched file
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+// NewWatcher processes spec, a pointer to a struct, with the given options and
+// then watches the config files and dotenv files they name, checking them
+// every interval.
+//
+// When a file changes, the pipeline is re-run into a fresh copy of the spec,
+// which is swapped in atomically and passed to onChange along with the
+// previous one. A reload that fails, for example because a file is only
+// partially written, leaves the current spec in place and is reported by Err.
+// Config readers are consumed by the first run, so only use options that can
+// be applied again.
+func NewWatcher(spec interface{}, interval time.Duration, onChange func(old, new interface{}), opts ...Option) (*Watcher, error) {
+	if err := ProcessWithOptions(spec, opts...); err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		opts:     opts,
+		onChange: onChange,
+		done:     make(chan struct{}),
+	}
+	w.spec.Store(spec)
+	w.stamps = w.stat()
+
+	go w.run(interval)
+	return w, nil
+}
+
+// Load returns the current specification. It must not be modified, since a
+// reload replaces it rather than updating it.
+func (w *Watcher) Load() interface{} {
+	return w.spec.Load()
+}
+
+// Err returns the error of the last reload, or nil if it succeeded.
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close stops watching the config files.
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+}
+
+func (w *Watcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.poll()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// poll reloads the specification if any of the watched files changed
+func (w *Watcher) poll() {
+	stamps := w.stat()
+
+	w.mu.Lock()
+	changed := !reflect.DeepEqual(stamps, w.stamps)
+	w.stamps = stamps
+	w.mu.Unlock()
+
+	if changed {
+		w.reload()
+	}
+}
+
+func (w *Watcher) reload() {
+	old := w.spec.Load()
+	fresh := reflect.New(reflect.TypeOf(old).Elem()).Interface()
+	err := ProcessWithOptions(fresh, w.opts...)
+
+	w.mu.Lock()
+	w.err = err
+	w.mu.Unlock()
+	if err != nil {
+		return
+	}
+
+	w.spec.Store(fresh)
+	if w.onChange != nil {
+		w.onChange(old, fresh)
+	}
+}
+
+// stat returns the current version of every watched file
+func (w *Watcher) stat() map[string]fileStamp {
+	o := newOptions(w.opts)
+	// config files are read from o.fsys if it is set, unlike dotenv files
+	var paths []string
+	for _, config := range o.configs {
+		if config.reader == nil && !config.url {
+			// a glob is watched for the files it currently matches
+			matches, _ := expandConfigPath(o.fsys, config.name)
+			paths = append(paths, matches...)
+		}
+	}
+	if path, err := o.environmentConfig(); err == nil && path != "" {
+		paths = append(paths, path)
+	}
+
+	stamps := make(map[string]fileStamp, len(paths)+len(o.dotenv))
+	for _, path := range paths {
+		stamps[path] = statFile(o.fsys, path)
+	}
+	for _, path := range o.dotenv {
+		stamps[path] = statFile(nil, path)
+	}
+	return stamps
+}
+
+// statFile returns the current version of the file at path in fsys, or on
+// disk if fsys is nil.
+func statFile(fsys fs.FS, path string) fileStamp {
+	var info fs.FileInfo
+	var err error
+	if fsys != nil {
+		info, err = fs.Stat(fsys, path)
+	} else {
+		info, err = os.Stat(path)
+	}
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2013 Kelsey Hightower. All rights reserved.
+// Use of this source code is governed by the MIT License that can be found in
+// the LICENSE file.
+
+package kkonfig
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.json", `{"Port": 8080}`)
+	changes := make(chan [2]*reloadSpecification, 1)
+	w, err := NewWatcher(&reloadSpecification{}, 10*time.Millisecond, func(old, new interface{}) {
+		changes <- [2]*reloadSpecification{old.(*reloadSpecification), new.(*reloadSpecification)}
+	}, WithConfigPaths(path))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer w.Close()
+
+	if port := w.Load().(*reloadSpecification).Port; port != 8080 {
+		t.Errorf("expected %d, got %d", 8080, port)
+	}
+
+	writeConfigFile(t, dir, "config.json", `{"Port": 18080}`)
+	select {
+	case change := <-changes:
+		if change[0].Port != 8080 {
+			t.Errorf("expected %d, got %d", 8080, change[0].Port)
+		}
+		if change[1].Port != 18080 {
+			t.Errorf("expected %d, got %d", 18080, change[1].Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reload")
+	}
+	if port := w.Load().(*reloadSpecification).Port; port != 18080 {
+		t.Errorf("expected %d, got %d", 18080, port)
+	}
+
+	// a partially written file is not applied
+	writeConfigFile(t, dir, "config.json", `{"Port": 2`)
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a failed reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := w.Err().(*ConfigFileError); !ok {
+		t.Errorf("expected ConfigFileError, got %v", w.Err())
+	}
+	if port := w.Load().(*reloadSpecification).Port; port != 18080 {
+		t.Errorf("expected %d, got %d", 18080, port)
+	}
+}
+
+func TestWatcherFS(t *testing.T) {
+	os.Clearenv()
+	dir, err := ioutil.TempDir("", "kkonfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeConfigFile(t, dir, "config.json", `{"Port": 8080}`)
+	changes := make(chan *reloadSpecification, 1)
+	w, err := NewWatcher(&reloadSpecification{}, 10*time.Millisecond, func(old, new interface{}) {
+		changes <- new.(*reloadSpecification)
+	}, WithFS(os.DirFS(dir)), WithConfigPaths("config.json"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer w.Close()
+
+	writeConfigFile(t, dir, "config.json", `{"Port": 18080}`)
+	select {
+	case change := <-changes:
+		if change.Port != 18080 {
+			t.Errorf("expected %d, got %d", 18080, change.Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a reload")
+	}
+}